@@ -0,0 +1,44 @@
+provider "aws" {
+  region = var.region
+}
+
+module "vpc" {
+  source  = "cloudposse/vpc/aws"
+  version = "3.0.0"
+
+  ipv4_primary_cidr_block = "172.16.0.0/16"
+
+  context = module.this.context
+}
+
+module "subnets" {
+  source = "../../"
+
+  availability_zones      = var.availability_zones
+  vpc_id                  = module.vpc.vpc_id
+  igw_id                  = [module.vpc.igw_id]
+  ipv4_enabled            = true
+  ipv6_enabled            = false
+  ipv6_egress_only_igw_id = [module.vpc.ipv6_egress_only_igw_id]
+  ipv4_cidr_block         = [module.vpc.vpc_cidr_block]
+  ipv6_cidr_block         = [module.vpc.vpc_ipv6_cidr_block]
+  nat_gateway_enabled     = false
+  nat_instance_enabled    = false
+  route_create_timeout    = "5m"
+  route_delete_timeout    = "10m"
+
+  subnet_type_tag_key = "cpco.io/subnet/type"
+
+  intra_subnets_enabled      = true
+  intra_subnets_per_az_count = var.intra_subnets_per_az_count
+  intra_subnets_per_az_names = var.intra_subnets_per_az_names
+
+  # The intra subnets go in the space the private and public subnets leave over: /20s, half their size
+  subnet_tiers = {
+    intra = {
+      subnets_per_az_sizes = { for name in var.intra_subnets_per_az_names : name => { newbits = 4 } }
+    }
+  }
+
+  context = module.this.context
+}
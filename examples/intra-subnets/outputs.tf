@@ -0,0 +1,34 @@
+output "public_subnet_cidrs" {
+  description = "IPv4 CIDRs assigned to the created public subnets"
+  value       = module.subnets.public_subnet_cidrs
+}
+
+output "private_subnet_cidrs" {
+  description = "IPv4 CIDRs assigned to the created private subnets"
+  value       = module.subnets.private_subnet_cidrs
+}
+
+output "intra_subnet_cidrs" {
+  description = "IPv4 CIDRs assigned to the created intra subnets"
+  value       = module.subnets.intra_subnet_cidrs
+}
+
+output "intra_route_table_ids" {
+  description = "IDs of the created intra route tables"
+  value       = module.subnets.intra_route_table_ids
+}
+
+output "az_intra_subnets_map" {
+  description = "Map of AZ names to list of intra subnet IDs in the AZs"
+  value       = module.subnets.az_intra_subnets_map
+}
+
+output "named_intra_subnets_map" {
+  description = "Map of subnet names (specified in `intra_subnets_per_az_names` variable) to lists of intra subnet IDs"
+  value       = module.subnets.named_intra_subnets_map
+}
+
+output "named_intra_subnets_stats_map" {
+  description = "Map of subnet names (specified in `intra_subnets_per_az_names` variable) to lists of objects with each object having three items: AZ, intra subnet ID, intra route table ID"
+  value       = module.subnets.named_intra_subnets_stats_map
+}
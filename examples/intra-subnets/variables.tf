@@ -0,0 +1,21 @@
+variable "region" {
+  type        = string
+  description = "AWS region"
+}
+
+variable "availability_zones" {
+  type        = list(string)
+  description = "List of Availability Zones where subnets will be created"
+}
+
+variable "intra_subnets_per_az_count" {
+  type        = number
+  description = "The number of intra subnets to provision per Availability Zone"
+  default     = 1
+}
+
+variable "intra_subnets_per_az_names" {
+  type        = list(string)
+  description = "The names to assign to the intra subnets per Availability Zone"
+  default     = ["database"]
+}
@@ -0,0 +1,59 @@
+provider "aws" {
+  region = var.region
+}
+
+module "vpc" {
+  source  = "cloudposse/vpc/aws"
+  version = "3.0.0"
+
+  ipv4_primary_cidr_block = "172.16.0.0/16"
+  ipv4_additional_cidr_block_associations = {
+    for cidr in [var.private_ipv4_cidr_block, var.pods_ipv4_cidr_block] : cidr => {
+      ipv4_cidr_block     = cidr
+      ipv4_ipam_pool_id   = null
+      ipv4_netmask_length = null
+    }
+  }
+
+  context = module.this.context
+}
+
+locals {
+  # Take the secondary CIDR blocks from the VPC module, so that the subnets are created after the CIDR blocks are associated
+  private_ipv4_cidr_block = one([for cidr in module.vpc.additional_cidr_blocks : cidr if cidr == var.private_ipv4_cidr_block])
+  pods_ipv4_cidr_block    = one([for cidr in module.vpc.additional_cidr_blocks : cidr if cidr == var.pods_ipv4_cidr_block])
+}
+
+module "subnets" {
+  source = "../../"
+
+  availability_zones      = var.availability_zones
+  vpc_id                  = module.vpc.vpc_id
+  igw_id                  = [module.vpc.igw_id]
+  ipv4_enabled            = true
+  ipv6_enabled            = false
+  ipv6_egress_only_igw_id = [module.vpc.ipv6_egress_only_igw_id]
+  ipv4_cidr_block         = [module.vpc.vpc_cidr_block]
+  ipv6_cidr_block         = [module.vpc.vpc_ipv6_cidr_block]
+  nat_gateway_enabled     = false
+  nat_instance_enabled    = false
+  route_create_timeout    = "5m"
+  route_delete_timeout    = "10m"
+
+  subnet_type_tag_key = "cpco.io/subnet/type"
+
+  private_subnets_per_az_count = length(var.private_subnets_per_az_names)
+  private_subnets_per_az_names = var.private_subnets_per_az_names
+
+  # The public subnets stay in the primary CIDR block, the private subnets go to the secondary CIDR blocks
+  subnet_tiers = {
+    private = {
+      ipv4_cidr_block = local.private_ipv4_cidr_block
+      subnet_ipv4_cidr_blocks = {
+        pods = local.pods_ipv4_cidr_block
+      }
+    }
+  }
+
+  context = module.this.context
+}
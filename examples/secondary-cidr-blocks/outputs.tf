@@ -0,0 +1,14 @@
+output "public_subnet_cidrs" {
+  description = "IPv4 CIDRs assigned to the created public subnets"
+  value       = module.subnets.public_subnet_cidrs
+}
+
+output "private_subnet_cidrs" {
+  description = "IPv4 CIDRs assigned to the created private subnets"
+  value       = module.subnets.private_subnet_cidrs
+}
+
+output "named_private_subnets_map" {
+  description = "Map of subnet names (specified in `private_subnets_per_az_names` variable) to lists of private subnet IDs"
+  value       = module.subnets.named_private_subnets_map
+}
@@ -0,0 +1,24 @@
+variable "region" {
+  type        = string
+  description = "AWS region"
+}
+
+variable "availability_zones" {
+  type        = list(string)
+  description = "List of Availability Zones where subnets will be created"
+}
+
+variable "private_subnets_per_az_names" {
+  type        = list(string)
+  description = "The names to assign to the private subnets per Availability Zone"
+}
+
+variable "private_ipv4_cidr_block" {
+  type        = string
+  description = "Secondary IPv4 CIDR block of the VPC in which to create the private subnets"
+}
+
+variable "pods_ipv4_cidr_block" {
+  type        = string
+  description = "Secondary IPv4 CIDR block of the VPC in which to create the private subnets named `pods`"
+}
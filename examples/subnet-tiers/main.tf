@@ -0,0 +1,36 @@
+provider "aws" {
+  region = var.region
+}
+
+module "vpc" {
+  source  = "cloudposse/vpc/aws"
+  version = "3.0.0"
+
+  ipv4_primary_cidr_block = "172.16.0.0/16"
+
+  context = module.this.context
+}
+
+module "subnets" {
+  source = "../../"
+
+  availability_zones      = var.availability_zones
+  vpc_id                  = module.vpc.vpc_id
+  igw_id                  = [module.vpc.igw_id]
+  ipv4_enabled            = true
+  ipv6_enabled            = false
+  ipv6_egress_only_igw_id = [module.vpc.ipv6_egress_only_igw_id]
+  ipv4_cidr_block         = [module.vpc.vpc_cidr_block]
+  ipv6_cidr_block         = [module.vpc.vpc_ipv6_cidr_block]
+  nat_gateway_enabled     = true
+  nat_instance_enabled    = false
+  max_nats                = 1
+  route_create_timeout    = "5m"
+  route_delete_timeout    = "10m"
+
+  subnet_type_tag_key = "cpco.io/subnet/type"
+
+  subnet_tiers = var.subnet_tiers
+
+  context = module.this.context
+}
@@ -0,0 +1,39 @@
+output "public_subnet_cidrs" {
+  description = "IPv4 CIDRs assigned to the created public subnets"
+  value       = module.subnets.public_subnet_cidrs
+}
+
+output "private_subnet_cidrs" {
+  description = "IPv4 CIDRs assigned to the created private subnets"
+  value       = module.subnets.private_subnet_cidrs
+}
+
+output "tier_subnet_ids" {
+  description = "Map of subnet tier name to the IDs of the subnets in that tier"
+  value       = module.subnets.tier_subnet_ids
+}
+
+output "tier_subnet_cidrs" {
+  description = "Map of subnet tier name to the IPv4 CIDRs of the subnets in that tier"
+  value       = module.subnets.tier_subnet_cidrs
+}
+
+output "tier_route_table_ids" {
+  description = "Map of subnet tier name to the IDs of the route tables in that tier"
+  value       = module.subnets.tier_route_table_ids
+}
+
+output "az_tier_subnets_map" {
+  description = "Map of subnet tier name to a map of AZ names to lists of subnet IDs in the AZs"
+  value       = module.subnets.az_tier_subnets_map
+}
+
+output "named_tier_subnets_map" {
+  description = "Map of subnet tier name to a map of subnet names to lists of subnet IDs"
+  value       = module.subnets.named_tier_subnets_map
+}
+
+output "nat_gateway_ids" {
+  description = "IDs of the NAT Gateways created"
+  value       = module.subnets.nat_gateway_ids
+}
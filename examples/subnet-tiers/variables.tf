@@ -0,0 +1,23 @@
+variable "region" {
+  type        = string
+  description = "AWS region"
+}
+
+variable "availability_zones" {
+  type        = list(string)
+  description = "List of Availability Zones where subnets will be created"
+}
+
+variable "subnet_tiers" {
+  type = map(object({
+    egress               = optional(string)
+    subnets_per_az_count = optional(number)
+    subnets_per_az_names = optional(list(string))
+    subnets_per_az_sizes = optional(map(object({
+      newbits    = optional(number)
+      host_count = optional(number)
+    })))
+  }))
+  description = "Map of subnet tier name to tier configuration, passed through to the `subnet_tiers` input of the module"
+  default     = {}
+}
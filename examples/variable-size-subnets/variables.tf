@@ -0,0 +1,23 @@
+variable "region" {
+  type        = string
+  description = "AWS region"
+}
+
+variable "availability_zones" {
+  type        = list(string)
+  description = "List of Availability Zones where subnets will be created"
+}
+
+variable "private_subnets_per_az_names" {
+  type        = list(string)
+  description = "The names to assign to the private subnets per Availability Zone"
+}
+
+variable "private_subnets_per_az_sizes" {
+  type = map(object({
+    newbits    = optional(number)
+    host_count = optional(number)
+  }))
+  description = "Map of private subnet name to the size of the IPv4 CIDR for subnets with that name"
+  default     = {}
+}
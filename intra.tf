@@ -0,0 +1,138 @@
+# Intra subnets are isolated: their route tables only ever have the VPC local routes,
+# so resources in them have no path to or from the internet.
+
+module "intra_label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+
+  attributes = [local.subnet_tiers.intra.label]
+  tags = merge(
+    local.subnet_tiers.intra.additional_tags,
+    var.subnet_type_tag_key != null && var.subnet_type_tag_value_format != null ? { (var.subnet_type_tag_key) = format(var.subnet_type_tag_value_format, local.subnet_tiers.intra.label) } : {}
+  )
+
+  context = module.this.context
+}
+
+resource "aws_subnet" "intra" {
+  for_each = local.intra_subnet_key_to_index_map
+
+  vpc_id            = local.vpc_id
+  availability_zone = local.intra_subnet_availability_zones[each.value]
+
+  cidr_block      = local.intra4_enabled ? local.ipv4_intra_subnet_cidrs[each.value] : null
+  ipv6_cidr_block = local.intra6_enabled ? local.ipv6_intra_subnet_cidrs[each.value] : null
+  ipv6_native     = local.intra6_enabled && !local.intra4_enabled
+
+  tags = merge(
+    module.intra_label.tags,
+    {
+      "Name" = format("%s%s%s", module.intra_label.id, local.delimiter, local.intra_subnet_az_abbreviations[each.value])
+    }
+  )
+
+  assign_ipv6_address_on_creation = local.intra6_enabled ? var.private_assign_ipv6_address_on_creation : null
+  # There is no NAT64 route, so DNS64 would only produce unreachable addresses
+  enable_dns64 = local.intra6_enabled ? false : null
+
+  enable_resource_name_dns_a_record_on_launch    = local.intra4_enabled ? var.ipv4_private_instance_hostnames_enabled : null
+  enable_resource_name_dns_aaaa_record_on_launch = local.intra6_enabled ? var.ipv6_private_instance_hostnames_enabled || !local.intra4_enabled : null
+
+  private_dns_hostname_type_on_launch = local.intra4_enabled ? var.ipv4_private_instance_hostname_type : null
+
+  lifecycle {
+    # Ignore tags added by kops or kubernetes
+    ignore_changes = [tags.kubernetes, tags.SubnetType]
+  }
+
+  timeouts {
+    create = var.subnet_create_timeout
+    delete = var.subnet_delete_timeout
+  }
+}
+
+resource "aws_route_table" "intra" {
+  # One route table per intra subnet
+  for_each = local.intra_subnet_key_to_index_map
+
+  vpc_id = local.vpc_id
+
+  tags = merge(
+    module.intra_label.tags,
+    {
+      "Name" = format("%s%s%s", module.intra_label.id, local.delimiter, local.intra_subnet_az_abbreviations[each.value])
+    }
+  )
+}
+
+resource "aws_route_table_association" "intra" {
+  for_each = local.intra_subnet_key_to_index_map
+
+  subnet_id      = aws_subnet.intra[each.key].id
+  route_table_id = aws_route_table.intra[each.key].id
+}
+
+resource "aws_network_acl" "intra" {
+  count = local.intra_network_acl_enabled ? 1 : 0
+
+  vpc_id     = local.vpc_id
+  subnet_ids = [for k in local.intra_subnet_keys : aws_subnet.intra[k].id if !contains(local.named_network_acl_subnet_keys.intra, k)]
+
+  tags = module.intra_label.tags
+}
+
+resource "aws_network_acl_rule" "intra4_ingress" {
+  count = local.intra_open_network_acl_enabled && local.intra4_enabled ? 1 : 0
+
+  network_acl_id = aws_network_acl.intra[0].id
+  rule_action    = "allow"
+  rule_number    = var.open_network_acl_ipv4_rule_number
+
+  egress     = false
+  cidr_block = "0.0.0.0/0" #tfsec:ignore:aws-ec2-no-public-ingress-acl
+  from_port  = 0
+  to_port    = 0
+  protocol   = "-1" #tfsec:ignore:aws-ec2-no-excessive-port-access
+}
+
+resource "aws_network_acl_rule" "intra4_egress" {
+  count = local.intra_open_network_acl_enabled && local.intra4_enabled ? 1 : 0
+
+  network_acl_id = aws_network_acl.intra[0].id
+  rule_action    = "allow"
+  rule_number    = var.open_network_acl_ipv4_rule_number
+
+  egress     = true
+  cidr_block = "0.0.0.0/0"
+  from_port  = 0
+  to_port    = 0
+  protocol   = "-1" #tfsec:ignore:aws-ec2-no-excessive-port-access
+}
+
+resource "aws_network_acl_rule" "intra6_ingress" {
+  count = local.intra_open_network_acl_enabled && local.intra6_enabled ? 1 : 0
+
+  network_acl_id = aws_network_acl.intra[0].id
+  rule_action    = "allow"
+  rule_number    = var.open_network_acl_ipv6_rule_number
+
+  egress          = false
+  ipv6_cidr_block = "::/0" #tfsec:ignore:aws-ec2-no-public-ingress-acl
+  from_port       = 0
+  to_port         = 0
+  protocol        = "-1" #tfsec:ignore:aws-ec2-no-excessive-port-access
+}
+
+resource "aws_network_acl_rule" "intra6_egress" {
+  count = local.intra_open_network_acl_enabled && local.intra6_enabled ? 1 : 0
+
+  network_acl_id = aws_network_acl.intra[0].id
+  rule_action    = "allow"
+  rule_number    = var.open_network_acl_ipv6_rule_number
+
+  egress          = true
+  ipv6_cidr_block = "::/0" #tfsec:ignore:aws-ec2-no-excessive-port-access
+  from_port       = 0
+  to_port         = 0
+  protocol        = "-1" #tfsec:ignore:aws-ec2-no-excessive-port-access
+}
@@ -0,0 +1,24 @@
+# When IPAM pools are given, every subnet CIDR is allocated from the pool rather than computed by this module.
+
+resource "aws_vpc_ipam_pool_cidr_allocation" "ipv4" {
+  for_each = local.ipv4_ipam_allocations
+
+  ipam_pool_id   = var.ipv4_ipam_pool_id[0]
+  netmask_length = each.value.netmask_length
+  description    = join(local.delimiter, compact([module.this.id, each.key]))
+
+  lifecycle {
+    precondition {
+      condition     = length(local.ipv4_ipam_newbits_sizes) == 0
+      error_message = "Subnet sizes given as `newbits` cannot be used with `ipv4_ipam_pool_id`, because there is no base CIDR block for them to be relative to. Use `host_count` for ${join(", ", local.ipv4_ipam_newbits_sizes)}."
+    }
+  }
+}
+
+resource "aws_vpc_ipam_pool_cidr_allocation" "ipv6" {
+  for_each = local.ipv6_ipam_allocations
+
+  ipam_pool_id   = var.ipv6_ipam_pool_id[0]
+  netmask_length = each.value.netmask_length
+  description    = join(local.delimiter, compact([module.this.id, each.key]))
+}
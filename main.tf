@@ -2,7 +2,9 @@
 # the rest of the code can consume.
 
 locals {
-  enabled = module.this.enabled && (var.public_subnets_enabled || var.private_subnets_enabled) && (var.ipv4_enabled || var.ipv6_enabled)
+  enabled = module.this.enabled && anytrue([
+    for v in values(local.subnet_tiers) : v.enabled && (v.ipv4_enabled || v.ipv6_enabled)
+  ])
 
   # We are going to reference `enabled` a *lot*, so abbreviate it
   e = local.enabled
@@ -64,22 +66,120 @@ locals {
 
   ################### End of Availability Zone Normalization #######################
 
+  #########################################
+  # Configure subnet tiers with backward compatibility
+  #
+  # The built-in private, public, and intra tiers are configured by the `private_*`, `public_*`, and `intra_*` inputs,
+  # any of which can be overridden by the entry with the same key in `subnet_tiers`.
+  # Every other entry in `subnet_tiers` is an additional tier.
+
+  builtin_subnet_tier_keys = ["private", "public", "intra"]
+
+  builtin_subnet_tiers = {
+    private = {
+      enabled                  = coalesce(try(var.subnet_tiers.private.enabled, null), var.private_subnets_enabled)
+      egress                   = "nat"
+      subnets_per_az_count     = coalesce(try(var.subnet_tiers.private.subnets_per_az_count, null), var.private_subnets_per_az_count, var.subnets_per_az_count)
+      subnets_per_az_names     = coalesce(try(var.subnet_tiers.private.subnets_per_az_names, null), var.private_subnets_per_az_names, var.subnets_per_az_names)
+      ipv4_enabled             = coalesce(try(var.subnet_tiers.private.ipv4_enabled, null), var.ipv4_enabled)
+      ipv6_enabled             = coalesce(try(var.subnet_tiers.private.ipv6_enabled, null), var.ipv6_enabled)
+      ipv4_cidrs               = coalesce(try(var.subnet_tiers.private.ipv4_cidrs, null), try(var.ipv4_cidrs[0].private, []))
+      ipv6_cidrs               = coalesce(try(var.subnet_tiers.private.ipv6_cidrs, null), try(var.ipv6_cidrs[0].private, []))
+      label                    = try(coalesce(var.subnet_tiers.private.label), var.private_label)
+      additional_tags          = coalesce(try(var.subnet_tiers.private.additional_tags, null), var.private_subnets_additional_tags)
+      open_network_acl_enabled = coalesce(try(var.subnet_tiers.private.open_network_acl_enabled, null), var.private_open_network_acl_enabled)
+      subnets_per_az_sizes     = coalesce(try(var.subnet_tiers.private.subnets_per_az_sizes, null), var.private_subnets_per_az_sizes)
+      ipv4_cidr_block          = try(var.subnet_tiers.private.ipv4_cidr_block, null)
+      subnet_ipv4_cidr_blocks  = coalesce(try(var.subnet_tiers.private.subnet_ipv4_cidr_blocks, null), {})
+      grid_slot                = 0
+    }
+    public = {
+      enabled                  = coalesce(try(var.subnet_tiers.public.enabled, null), var.public_subnets_enabled)
+      egress                   = "igw"
+      subnets_per_az_count     = coalesce(try(var.subnet_tiers.public.subnets_per_az_count, null), var.public_subnets_per_az_count, var.subnets_per_az_count)
+      subnets_per_az_names     = coalesce(try(var.subnet_tiers.public.subnets_per_az_names, null), var.public_subnets_per_az_names, var.subnets_per_az_names)
+      ipv4_enabled             = coalesce(try(var.subnet_tiers.public.ipv4_enabled, null), var.ipv4_enabled)
+      ipv6_enabled             = coalesce(try(var.subnet_tiers.public.ipv6_enabled, null), var.ipv6_enabled)
+      ipv4_cidrs               = coalesce(try(var.subnet_tiers.public.ipv4_cidrs, null), try(var.ipv4_cidrs[0].public, []))
+      ipv6_cidrs               = coalesce(try(var.subnet_tiers.public.ipv6_cidrs, null), try(var.ipv6_cidrs[0].public, []))
+      label                    = try(coalesce(var.subnet_tiers.public.label), var.public_label)
+      additional_tags          = coalesce(try(var.subnet_tiers.public.additional_tags, null), var.public_subnets_additional_tags)
+      open_network_acl_enabled = coalesce(try(var.subnet_tiers.public.open_network_acl_enabled, null), var.public_open_network_acl_enabled)
+      subnets_per_az_sizes     = coalesce(try(var.subnet_tiers.public.subnets_per_az_sizes, null), var.public_subnets_per_az_sizes)
+      ipv4_cidr_block          = try(var.subnet_tiers.public.ipv4_cidr_block, null)
+      subnet_ipv4_cidr_blocks  = coalesce(try(var.subnet_tiers.public.subnet_ipv4_cidr_blocks, null), {})
+      grid_slot                = 1
+    }
+    # Isolated subnets with no route to the internet
+    intra = {
+      enabled                  = coalesce(try(var.subnet_tiers.intra.enabled, null), var.intra_subnets_enabled)
+      egress                   = "none"
+      subnets_per_az_count     = coalesce(try(var.subnet_tiers.intra.subnets_per_az_count, null), var.intra_subnets_per_az_count, var.subnets_per_az_count)
+      subnets_per_az_names     = coalesce(try(var.subnet_tiers.intra.subnets_per_az_names, null), var.intra_subnets_per_az_names, var.subnets_per_az_names)
+      ipv4_enabled             = coalesce(try(var.subnet_tiers.intra.ipv4_enabled, null), var.ipv4_enabled)
+      ipv6_enabled             = coalesce(try(var.subnet_tiers.intra.ipv6_enabled, null), var.ipv6_enabled)
+      ipv4_cidrs               = coalesce(try(var.subnet_tiers.intra.ipv4_cidrs, null), try(var.ipv4_cidrs[0].intra, []))
+      ipv6_cidrs               = coalesce(try(var.subnet_tiers.intra.ipv6_cidrs, null), try(var.ipv6_cidrs[0].intra, []))
+      label                    = try(coalesce(var.subnet_tiers.intra.label), var.intra_label)
+      additional_tags          = coalesce(try(var.subnet_tiers.intra.additional_tags, null), var.intra_subnets_additional_tags)
+      open_network_acl_enabled = coalesce(try(var.subnet_tiers.intra.open_network_acl_enabled, null), var.intra_open_network_acl_enabled)
+      subnets_per_az_sizes     = coalesce(try(var.subnet_tiers.intra.subnets_per_az_sizes, null), {})
+      ipv4_cidr_block          = try(var.subnet_tiers.intra.ipv4_cidr_block, null)
+      subnet_ipv4_cidr_blocks  = coalesce(try(var.subnet_tiers.intra.subnet_ipv4_cidr_blocks, null), {})
+      grid_slot                = 2
+    }
+  }
+
+  additional_subnet_tiers = {
+    for k, v in var.subnet_tiers : k => {
+      enabled              = coalesce(v.enabled, true)
+      egress               = v.egress
+      subnets_per_az_count = v.subnets_per_az_names == null ? coalesce(v.subnets_per_az_count, 1) : length(v.subnets_per_az_names)
+      # Without names, a single subnet is named after the tier, and several are named by their position
+      subnets_per_az_names = v.subnets_per_az_names == null ? (
+        coalesce(v.subnets_per_az_count, 1) == 1 ? tolist([k]) : [for i in range(coalesce(v.subnets_per_az_count, 1)) : tostring(i)]
+      ) : v.subnets_per_az_names
+      ipv4_enabled             = coalesce(v.ipv4_enabled, var.ipv4_enabled)
+      ipv6_enabled             = coalesce(v.ipv6_enabled, var.ipv6_enabled)
+      ipv4_cidrs               = coalesce(v.ipv4_cidrs, [])
+      ipv6_cidrs               = coalesce(v.ipv6_cidrs, [])
+      label                    = coalesce(v.label, k)
+      additional_tags          = coalesce(v.additional_tags, {})
+      open_network_acl_enabled = coalesce(v.open_network_acl_enabled, true)
+      subnets_per_az_sizes     = coalesce(v.subnets_per_az_sizes, {})
+      ipv4_cidr_block          = v.ipv4_cidr_block
+      subnet_ipv4_cidr_blocks  = coalesce(v.subnet_ipv4_cidr_blocks, {})
+      grid_slot                = v.grid_slot
+    } if !contains(local.builtin_subnet_tier_keys, k)
+  }
+
+  subnet_tiers = merge(local.additional_subnet_tiers, local.builtin_subnet_tiers)
+
+  # Additional tiers are kept in alphabetical order so that CIDR reservations are reproducible
+  additional_subnet_tier_keys = sort(keys(local.additional_subnet_tiers))
+  subnet_tier_keys            = concat(local.builtin_subnet_tier_keys, local.additional_subnet_tier_keys)
+
+  ################### End of subnet tier configuration #######################
+
   #########################################
   # Configure subnet counts per AZ with backward compatibility
 
-  # Use new variables if provided, otherwise fall back to legacy variables
-  public_subnets_per_az_count  = coalesce(var.public_subnets_per_az_count, var.subnets_per_az_count)
-  private_subnets_per_az_count = coalesce(var.private_subnets_per_az_count, var.subnets_per_az_count)
+  public_subnets_per_az_count  = local.subnet_tiers.public.subnets_per_az_count
+  private_subnets_per_az_count = local.subnet_tiers.private.subnets_per_az_count
+  intra_subnets_per_az_count   = local.subnet_tiers.intra.subnets_per_az_count
 
-  public_subnets_per_az_names  = var.public_subnets_per_az_names != null ? var.public_subnets_per_az_names : var.subnets_per_az_names
-  private_subnets_per_az_names = var.private_subnets_per_az_names != null ? var.private_subnets_per_az_names : var.subnets_per_az_names
+  public_subnets_per_az_names  = local.subnet_tiers.public.subnets_per_az_names
+  private_subnets_per_az_names = local.subnet_tiers.private.subnets_per_az_names
+  intra_subnets_per_az_names   = local.subnet_tiers.intra.subnets_per_az_names
 
   # Create separate availability zone lists for public and private subnets
   public_subnet_availability_zones  = local.public_enabled ? flatten([for z in local.vpc_availability_zones : [for net in range(0, local.public_subnets_per_az_count) : z]]) : []
   private_subnet_availability_zones = local.private_enabled ? flatten([for z in local.vpc_availability_zones : [for net in range(0, local.private_subnets_per_az_count) : z]]) : []
+  intra_subnet_availability_zones   = local.intra_enabled ? flatten([for z in local.vpc_availability_zones : [for net in range(0, local.intra_subnets_per_az_count) : z]]) : []
 
   public_subnet_az_count  = local.public_enabled ? length(local.public_subnet_availability_zones) : 0
   private_subnet_az_count = local.private_enabled ? length(local.private_subnet_availability_zones) : 0
+  intra_subnet_az_count   = local.intra_enabled ? length(local.intra_subnet_availability_zones) : 0
 
   # Number of availability zones being used (for NAT gateways, one per AZ)
   vpc_az_count = length(local.vpc_availability_zones)
@@ -87,6 +187,38 @@ locals {
   # Create separate AZ abbreviation lists for public and private subnets
   public_subnet_az_abbreviations  = [for az in local.public_subnet_availability_zones : local.az_abbreviation_map[az]]
   private_subnet_az_abbreviations = [for az in local.private_subnet_availability_zones : local.az_abbreviation_map[az]]
+  intra_subnet_az_abbreviations   = [for az in local.intra_subnet_availability_zones : local.az_abbreviation_map[az]]
+
+  # Subnets are created with `for_each`, keyed by "<short AZ code>/<subnet name>", e.g. "use2a/app",
+  # so that adding or removing an Availability Zone or a subnet name does not renumber (and replace) the other subnets.
+  # A position that has no name of its own (because there are more subnets per AZ than names, or the name is repeated)
+  # is identified by its index instead.
+  az_key_map = module.utils.region_az_alt_code_maps.to_short
+
+  subnet_tier_key_names = {
+    for k in local.subnet_tier_keys : k => [
+      for i in range(local.subnet_tiers[k].subnets_per_az_count) : try(
+        index(local.subnet_tiers[k].subnets_per_az_names, local.subnet_tiers[k].subnets_per_az_names[i]) == i ? local.subnet_tiers[k].subnets_per_az_names[i] : tostring(i),
+        tostring(i)
+      )
+    ]
+  }
+
+  # Keys are listed in the same order as the subnets' CIDRs: by AZ, then by position in `subnets_per_az_names`
+  subnet_tier_subnet_keys = {
+    for k in local.subnet_tier_keys : k => local.e && local.subnet_tiers[k].enabled ? flatten([
+      for az in local.vpc_availability_zones : [for n in local.subnet_tier_key_names[k] : format("%s/%s", local.az_key_map[az], n)]
+    ]) : []
+  }
+
+  public_subnet_keys  = local.subnet_tier_subnet_keys.public
+  private_subnet_keys = local.subnet_tier_subnet_keys.private
+  intra_subnet_keys   = local.subnet_tier_subnet_keys.intra
+
+  # The `for_each` maps of the built-in tiers map each key to the subnet's index in the lists above
+  public_subnet_key_to_index_map  = { for i, k in local.public_subnet_keys : k => i }
+  private_subnet_key_to_index_map = { for i, k in local.private_subnet_keys : k => i }
+  intra_subnet_key_to_index_map   = { for i, k in local.intra_subnet_keys : k => i }
 
   ################### End of subnet count configuration #######################
 
@@ -98,72 +230,577 @@ locals {
   existing_az_count = local.e ? length(data.aws_availability_zones.default[0].names) : 0
   max_az_count      = var.max_subnet_count == 0 ? local.existing_az_count : var.max_subnet_count
 
-  # Calculate CIDR reservations separately for public and private subnets
-  private_cidr_reservations = (local.private_enabled ? 1 : 0) * local.max_az_count * local.private_subnets_per_az_count
-  public_cidr_reservations  = (local.public_enabled ? 1 : 0) * local.max_az_count * local.public_subnets_per_az_count
-  cidr_reservations         = local.private_cidr_reservations + local.public_cidr_reservations
-
+  # Reserve CIDRs for each tier in turn: the private subnets get the lowest range (for backward compatibility),
+  # followed by the public subnets, the intra subnets, and then the additional tiers.
+  subnet_tier_cidr_reservation_list = [
+    for k in local.subnet_tier_keys : local.e && local.subnet_tiers[k].enabled ? local.max_az_count * local.subnet_tiers[k].subnets_per_az_count : 0
+  ]
+  subnet_tier_cidr_reservations = zipmap(local.subnet_tier_keys, local.subnet_tier_cidr_reservation_list)
+  subnet_tier_cidr_offsets = {
+    for i, k in local.subnet_tier_keys : k => sum(concat([0], slice(local.subnet_tier_cidr_reservation_list, 0, i)))
+  }
 
-  # Calculate how many bits are required to designate a subnet,
-  # but also prevent errors like log(0) when things are disabled.
-  required_ipv4_subnet_bits = local.e ? ceil(log(local.cidr_reservations, 2)) : 1
+  # IPv4 CIDRs are sized below, in the CIDR block each subnet is placed in
   required_ipv6_subnet_bits = 8 # Currently the only value allowed by AWS
 
-  supplied_ipv4_private_subnet_cidrs = try(var.ipv4_cidrs[0].private, [])
-  supplied_ipv4_public_subnet_cidrs  = try(var.ipv4_cidrs[0].public, [])
-
-  supplied_ipv6_private_subnet_cidrs = try(var.ipv6_cidrs[0].private, [])
-  supplied_ipv6_public_subnet_cidrs  = try(var.ipv6_cidrs[0].public, [])
+  supplied_ipv4_subnet_tier_cidrs = { for k, v in local.subnet_tiers : k => v.ipv4_cidrs }
+  supplied_ipv6_subnet_tier_cidrs = { for k, v in local.subnet_tiers : k => v.ipv6_cidrs }
 
-  compute_ipv4_cidrs = local.ipv4_enabled && (length(local.supplied_ipv4_private_subnet_cidrs) + length(local.supplied_ipv4_public_subnet_cidrs)) == 0
-  compute_ipv6_cidrs = local.ipv6_enabled && (length(local.supplied_ipv6_private_subnet_cidrs) + length(local.supplied_ipv6_public_subnet_cidrs)) == 0
+  # Supplied CIDRs take precedence over IPAM pools, which take precedence over dividing up the base CIDR block
+  ipv4_ipam_enabled  = local.ipv4_enabled && length(var.ipv4_ipam_pool_id) > 0 && length(flatten(values(local.supplied_ipv4_subnet_tier_cidrs))) == 0
+  ipv6_ipam_enabled  = local.ipv6_enabled && length(var.ipv6_ipam_pool_id) > 0 && length(flatten(values(local.supplied_ipv6_subnet_tier_cidrs))) == 0
+  compute_ipv4_cidrs = local.ipv4_enabled && !local.ipv4_ipam_enabled && length(flatten(values(local.supplied_ipv4_subnet_tier_cidrs))) == 0
+  compute_ipv6_cidrs = local.ipv6_enabled && !local.ipv6_ipam_enabled && length(flatten(values(local.supplied_ipv6_subnet_tier_cidrs))) == 0
   need_vpc_data      = (local.compute_ipv4_cidrs && length(var.ipv4_cidr_block) == 0) || (local.compute_ipv6_cidrs && length(var.ipv6_cidr_block) == 0)
 
   base_ipv4_cidr_block = length(var.ipv4_cidr_block) > 0 ? var.ipv4_cidr_block[0] : (local.need_vpc_data ? data.aws_vpc.default[0].cidr_block : "")
   base_ipv6_cidr_block = length(var.ipv6_cidr_block) > 0 ? var.ipv6_cidr_block[0] : (local.need_vpc_data ? data.aws_vpc.default[0].ipv6_cidr_block : "")
 
-  # For backward compatibility, private subnets get the lower CIDR range
-  ipv4_private_subnet_cidrs = local.compute_ipv4_cidrs ? [
-    for net in range(0, local.private_cidr_reservations) : cidrsubnet(local.base_ipv4_cidr_block, local.required_ipv4_subnet_bits, net)
-  ] : local.supplied_ipv4_private_subnet_cidrs
+  ipv4_subnet_tier_cidrs = {
+    for k in local.subnet_tier_keys : k => local.ipv4_ipam_enabled ? [
+      for sk in local.subnet_tier_subnet_keys[k] : aws_vpc_ipam_pool_cidr_allocation.ipv4[format("%s/%s", k, sk)].cidr if local.subnet_tiers[k].ipv4_enabled
+      ] : local.compute_ipv4_cidrs ? (local.cidr_grid_enabled ? local.ipv4_grid_subnet_tier_cidrs[k] : [
+        for i, s in local.ipv4_cidr_slots : local.ipv4_packed_cidrs[i] if s.tier == k
+    ]) : local.supplied_ipv4_subnet_tier_cidrs[k]
+  }
 
-  ipv4_public_subnet_cidrs = local.compute_ipv4_cidrs ? [
-    for net in range(local.private_cidr_reservations, local.cidr_reservations) : cidrsubnet(local.base_ipv4_cidr_block, local.required_ipv4_subnet_bits, net)
-  ] : local.supplied_ipv4_public_subnet_cidrs
+  ipv6_subnet_tier_cidrs = {
+    for k in local.subnet_tier_keys : k => local.ipv6_ipam_enabled ? [
+      for sk in local.subnet_tier_subnet_keys[k] : aws_vpc_ipam_pool_cidr_allocation.ipv6[format("%s/%s", k, sk)].cidr if local.subnet_tiers[k].ipv6_enabled
+      ] : local.compute_ipv6_cidrs ? (local.cidr_grid_enabled ? [
+        for net in local.cidr_grid_subnet_tier_cells[k] : cidrsubnet(local.base_ipv6_cidr_block, local.required_ipv6_subnet_bits, net)
+        ] : [
+        for net in range(local.subnet_tier_cidr_offsets[k], local.subnet_tier_cidr_offsets[k] + local.subnet_tier_cidr_reservations[k]) :
+        cidrsubnet(local.base_ipv6_cidr_block, local.required_ipv6_subnet_bits, net)
+    ]) : local.supplied_ipv6_subnet_tier_cidrs[k]
+  }
 
-  ipv6_private_subnet_cidrs = local.compute_ipv6_cidrs ? [
-    for net in range(0, local.private_cidr_reservations) : cidrsubnet(local.base_ipv6_cidr_block, local.required_ipv6_subnet_bits, net)
-  ] : local.supplied_ipv6_private_subnet_cidrs
+  # IPAM allocations are made only for the subnets actually created, not for the reserved CIDRs,
+  # and are keyed by tier and subnet key, e.g. "private/use2a/app".
+  ipv4_ipam_allocations = local.ipv4_ipam_enabled ? merge([
+    for k in local.subnet_tier_keys : {
+      for i, sk in local.subnet_tier_subnet_keys[k] : format("%s/%s", k, sk) => {
+        # Subnets with a `host_count` size get just enough addresses, plus the 5 AWS reserves, but at least a /28
+        netmask_length = try(min(28, 32 - ceil(log(local.subnet_tiers[k].subnets_per_az_sizes[local.subnet_tiers[k].subnets_per_az_names[i % local.subnet_tiers[k].subnets_per_az_count]].host_count + 5, 2))), var.ipv4_ipam_netmask_length)
+      } if local.subnet_tiers[k].ipv4_enabled
+    }
+  ]...) : {}
 
-  ipv6_public_subnet_cidrs = local.compute_ipv6_cidrs ? [
-    for net in range(local.private_cidr_reservations, local.cidr_reservations) : cidrsubnet(local.base_ipv6_cidr_block, local.required_ipv6_subnet_bits, net)
-  ] : local.supplied_ipv6_public_subnet_cidrs
+  # A `newbits` size is relative to a base CIDR block, which IPAM allocations do not have, so it is rejected
+  ipv4_ipam_newbits_sizes = local.ipv4_ipam_enabled ? flatten([
+    for k in local.subnet_tier_keys : [
+      for name, size in local.subnet_tiers[k].subnets_per_az_sizes : format("%s/%s", k, name) if size.newbits != null
+    ] if local.subnet_tiers[k].enabled && local.subnet_tiers[k].ipv4_enabled
+  ]) : []
+
+  ipv6_ipam_allocations = local.ipv6_ipam_enabled ? merge([
+    for k in local.subnet_tier_keys : {
+      for sk in local.subnet_tier_subnet_keys[k] : format("%s/%s", k, sk) => {
+        netmask_length = var.ipv6_ipam_netmask_length
+      } if local.subnet_tiers[k].ipv6_enabled
+    }
+  ]...) : {}
+
+  ipv4_private_subnet_cidrs = local.ipv4_subnet_tier_cidrs.private
+  ipv4_public_subnet_cidrs  = local.ipv4_subnet_tier_cidrs.public
+  ipv6_private_subnet_cidrs = local.ipv6_subnet_tier_cidrs.private
+  ipv6_public_subnet_cidrs  = local.ipv6_subnet_tier_cidrs.public
+  ipv4_intra_subnet_cidrs   = local.ipv4_subnet_tier_cidrs.intra
+  ipv6_intra_subnet_cidrs   = local.ipv6_subnet_tier_cidrs.intra
+
+  #########################################
+  # Configure variable-length IPv4 CIDRs
+  #
+  # Every reserved CIDR (the same reservations as above, in the same order) is a "slot" in a CIDR block:
+  # the secondary CIDR block given for its tier or subnet name, or else the base CIDR block.
+  # Each slot has its own netmask: the size given for its subnet name, or else the number of bits required
+  # to give every slot in its CIDR block a CIDR of the same size.
+  # Within each CIDR block, the private and public slots are sorted largest first (ties broken by their original
+  # order), and then laid out one after the other, followed by the slots of the other tiers, sorted the same way.
+  # Since every size is a power of 2 and no slot is larger than the one before it, every slot is naturally aligned.
+  # Without any sizes, secondary CIDR blocks, or other tiers, this is the same as dividing the base CIDR block
+  # into as many equal CIDRs as are reserved.
+
+  subnet_tier_ipv4_cidr_blocks = {
+    for k in local.subnet_tier_keys : k => [
+      for i in range(local.subnet_tiers[k].subnets_per_az_count) : lookup(
+        local.subnet_tiers[k].subnet_ipv4_cidr_blocks,
+        try(local.subnet_tiers[k].subnets_per_az_names[i], ""),
+        local.subnet_tiers[k].ipv4_cidr_block == null ? local.base_ipv4_cidr_block : local.subnet_tiers[k].ipv4_cidr_block
+      )
+    ]
+  }
+
+  # The `newbits` of the size given for each subnet position in each tier, or `null` if no size is given
+  subnet_tier_ipv4_size_newbits = {
+    for k in local.subnet_tier_keys : k => [
+      for i in range(local.compute_ipv4_cidrs ? local.subnet_tiers[k].subnets_per_az_count : 0) : (
+        lookup(local.subnet_tiers[k].subnets_per_az_sizes, try(local.subnet_tiers[k].subnets_per_az_names[i], ""), null) == null ? null : (
+          local.subnet_tiers[k].subnets_per_az_sizes[local.subnet_tiers[k].subnets_per_az_names[i]].newbits != null ?
+          local.subnet_tiers[k].subnets_per_az_sizes[local.subnet_tiers[k].subnets_per_az_names[i]].newbits :
+          # AWS reserves 5 addresses in every subnet, and the smallest subnet it allows is a /28
+          min(28, 32 - ceil(log(local.subnet_tiers[k].subnets_per_az_sizes[local.subnet_tiers[k].subnets_per_az_names[i]].host_count + 5, 2))) - tonumber(split("/", local.subnet_tier_ipv4_cidr_blocks[k][i])[1])
+        )
+      )
+    ]
+  }
+
+  ipv4_cidr_slot_list = local.compute_ipv4_cidrs && !local.cidr_grid_enabled ? flatten([
+    for k in local.subnet_tier_keys : [
+      for az in range(local.subnet_tier_cidr_reservations[k] > 0 ? local.max_az_count : 0) : [
+        for i in range(local.subnet_tiers[k].subnets_per_az_count) : {
+          tier       = k
+          cidr_block = local.subnet_tier_ipv4_cidr_blocks[k][i]
+          newbits    = local.subnet_tier_ipv4_size_newbits[k][i]
+          appended   = !contains(["private", "public"], k)
+        }
+      ]
+    ]
+  ]) : []
+
+  # The CIDR blocks that subnets are placed in, and the bits required to divide each one among its slots.
+  # The slots of the intra and additional tiers are appended after those of the private and public tiers, and do not
+  # count towards the bits of a block that also holds private or public slots, so that enabling the intra tier or
+  # adding a tier never changes the CIDRs of the private and public subnets. When they do not fit, the plan fails.
+  ipv4_cidr_slot_blocks = distinct([for s in local.ipv4_cidr_slot_list : s.cidr_block])
+  ipv4_cidr_slot_block_required_bits = [
+    for b in local.ipv4_cidr_slot_blocks : ceil(log(max(1, anytrue([for s in local.ipv4_cidr_slot_list : s.cidr_block == b && !s.appended]) ?
+      length([for s in local.ipv4_cidr_slot_list : s if s.cidr_block == b && !s.appended]) :
+      length([for s in local.ipv4_cidr_slot_list : s if s.cidr_block == b])
+    ), 2))
+  ]
+
+  ipv4_cidr_slots = [
+    for s in local.ipv4_cidr_slot_list : {
+      tier        = s.tier
+      cidr_block  = s.cidr_block
+      block_index = index(local.ipv4_cidr_slot_blocks, s.cidr_block)
+      sized       = s.newbits != null
+      appended    = s.appended
+      newbits     = s.newbits != null ? s.newbits : local.ipv4_cidr_slot_block_required_bits[index(local.ipv4_cidr_slot_blocks, s.cidr_block)]
+    }
+  ]
+
+  ipv4_cidr_slot_order = [
+    for key in sort([for i, s in local.ipv4_cidr_slots : format("%03d/%d/%03d/%06d", s.block_index, s.appended ? 1 : 0, s.newbits, i)]) : tonumber(split("/", key)[3])
+  ]
+  ipv4_cidr_slot_block_max_newbits = [
+    for b in range(length(local.ipv4_cidr_slot_blocks)) : max(concat([0], [for s in local.ipv4_cidr_slots : s.newbits if s.block_index == b])...)
+  ]
+  # Size of each slot, in sorted order, in units of the smallest slot in the same CIDR block
+  ipv4_cidr_slot_units = [
+    for i in local.ipv4_cidr_slot_order : pow(2, local.ipv4_cidr_slot_block_max_newbits[local.ipv4_cidr_slots[i].block_index] - local.ipv4_cidr_slots[i].newbits)
+  ]
+
+  # The appended slots start after the private and public slots, at a multiple of the largest appended slot
+  ipv4_cidr_slot_block_appended_start = [
+    for b in range(length(local.ipv4_cidr_slot_blocks)) : ceil(sum(concat([0], [
+      for j, i in local.ipv4_cidr_slot_order : local.ipv4_cidr_slot_units[j] if local.ipv4_cidr_slots[i].block_index == b && !local.ipv4_cidr_slots[i].appended
+      ])) / max(concat([1], [
+      for j, i in local.ipv4_cidr_slot_order : local.ipv4_cidr_slot_units[j] if local.ipv4_cidr_slots[i].block_index == b && local.ipv4_cidr_slots[i].appended
+    ])...)) * max(concat([1], [
+      for j, i in local.ipv4_cidr_slot_order : local.ipv4_cidr_slot_units[j] if local.ipv4_cidr_slots[i].block_index == b && local.ipv4_cidr_slots[i].appended
+    ])...)
+  ]
+  # The offset of each slot, in sorted order, in units of the smallest slot in the same CIDR block
+  ipv4_cidr_slot_offsets = [
+    for j, i in local.ipv4_cidr_slot_order : (local.ipv4_cidr_slots[i].appended ? local.ipv4_cidr_slot_block_appended_start[local.ipv4_cidr_slots[i].block_index] : 0) + sum(concat([0], [
+      for jj, u in slice(local.ipv4_cidr_slot_units, 0, j) : u
+      if local.ipv4_cidr_slots[local.ipv4_cidr_slot_order[jj]].block_index == local.ipv4_cidr_slots[i].block_index && local.ipv4_cidr_slots[local.ipv4_cidr_slot_order[jj]].appended == local.ipv4_cidr_slots[i].appended
+    ]))
+  ]
+
+  # Sizes can add up to more than a CIDR block holds, which is reported by a precondition.
+  # Until then, the slots that do not fit are clamped to the end of the block so that the CIDRs can still be computed.
+  ipv4_cidr_slot_block_units = [
+    for b in range(length(local.ipv4_cidr_slot_blocks)) : max(concat([0], [
+      for j, i in local.ipv4_cidr_slot_order : local.ipv4_cidr_slot_offsets[j] + local.ipv4_cidr_slot_units[j] if local.ipv4_cidr_slots[i].block_index == b
+    ])...)
+  ]
+  ipv4_cidr_slot_invalid_reasons = compact(flatten([
+    for b, block in local.ipv4_cidr_slot_blocks : [
+      local.ipv4_cidr_slot_block_units[b] > pow(2, local.ipv4_cidr_slot_block_max_newbits[b]) ? format(
+        "%s holds %d /%d CIDRs, but the subnets placed in it need %d, so give the %s tier(s) smaller `subnets_per_az_sizes` or a CIDR block of their own (`ipv4_cidr_block`), or enable `cidr_grid`",
+        block, pow(2, local.ipv4_cidr_slot_block_max_newbits[b]), tonumber(split("/", block)[1]) + local.ipv4_cidr_slot_block_max_newbits[b],
+        local.ipv4_cidr_slot_block_units[b], join(", ", distinct([for s in local.ipv4_cidr_slots : s.tier if s.block_index == b && (s.sized || s.appended)]))
+      ) : "",
+      [for t in distinct([for s in local.ipv4_cidr_slots : s.tier if s.block_index == b && s.newbits < 0]) : format("a subnet of the %s tier is larger than %s", t, block)],
+      [for t in distinct([for s in local.ipv4_cidr_slots : s.tier if s.block_index == b && tonumber(split("/", block)[1]) + s.newbits > 28]) : format(
+        "a subnet of the %s tier in %s is smaller than a /28, the smallest subnet AWS allows", t, block
+      )],
+    ]
+  ]))
+
+  ipv4_packed_cidrs = {
+    for j, i in local.ipv4_cidr_slot_order : i => cidrsubnet(
+      local.ipv4_cidr_slots[i].cidr_block,
+      max(local.ipv4_cidr_slots[i].newbits, 0),
+      min(local.ipv4_cidr_slot_offsets[j] / local.ipv4_cidr_slot_units[j], pow(2, max(local.ipv4_cidr_slots[i].newbits, 0)) - 1)
+    )
+  }
+
+  # Every IPv4 CIDR block that subnets are placed in. When the subnet CIDRs are supplied or allocated from IPAM
+  # and no base CIDR block is given, fall back to the subnet CIDRs themselves.
+  ipv4_cidr_blocks_in_use = distinct(compact(concat([local.base_ipv4_cidr_block], flatten([
+    for v in values(local.subnet_tiers) : concat(v.ipv4_cidr_block == null ? [] : [v.ipv4_cidr_block], values(v.subnet_ipv4_cidr_blocks)) if v.enabled && v.ipv4_enabled
+  ]))))
+  vpc_ingress_ipv4_cidrs = length(local.ipv4_cidr_blocks_in_use) > 0 ? local.ipv4_cidr_blocks_in_use : distinct(compact(flatten(values(local.ipv4_subnet_tier_cidrs))))
+
+  #########################################
+  # Configure grid-pinned CIDRs
+  #
+  # With `cidr_grid` enabled, each CIDR block is divided into `tier_slots * az_slots * subnet_slots` equal cells instead,
+  # and each subnet gets the cell for its tier, its AZ, and its position in the tier's list of subnet names.
+  # The tier is identified by its `grid_slot` (fixed for the built-in tiers, and set explicitly for the additional tiers),
+  # and the AZ by the letter at the end of its name, rather than by their positions in the lists of tiers and AZs,
+  # so adding a tier or an AZ never moves the cells of the others. Only subnets actually created get a cell.
+
+  cidr_grid_enabled = local.e && var.cidr_grid.enabled
+  cidr_grid_bits    = ceil(log(var.cidr_grid.tier_slots * var.cidr_grid.az_slots * var.cidr_grid.subnet_slots, 2))
+
+  cidr_grid_az_ordinals = {
+    for az in local.vpc_availability_zones : az => try(index(split("", "abcdefghijklmnopqrstuvwxyz"), substr(az, -1, 1)), null)
+  }
+
+  cidr_grid_subnet_tier_cells = {
+    for k in local.subnet_tier_keys : k => flatten([
+      for az in local.vpc_availability_zones : [
+        for i in range(local.cidr_grid_enabled && local.subnet_tier_cidr_reservations[k] > 0 ? local.subnet_tiers[k].subnets_per_az_count : 0) :
+        (coalesce(local.subnet_tiers[k].grid_slot, 0) * var.cidr_grid.az_slots + coalesce(local.cidr_grid_az_ordinals[az], 0)) * var.cidr_grid.subnet_slots + i
+      ]
+    ])
+  }
+
+  # A sized subnet gets the lowest CIDR of that size in its cell
+  ipv4_grid_subnet_tier_cidrs = {
+    for k in local.subnet_tier_keys : k => [
+      for j in range(local.compute_ipv4_cidrs ? length(local.cidr_grid_subnet_tier_cells[k]) : 0) : cidrsubnet(
+        cidrsubnet(local.subnet_tier_ipv4_cidr_blocks[k][j % local.subnet_tiers[k].subnets_per_az_count], local.cidr_grid_bits, local.cidr_grid_subnet_tier_cells[k][j]),
+        max(local.cidr_grid_bits, coalesce(local.subnet_tier_ipv4_size_newbits[k][j % local.subnet_tiers[k].subnets_per_az_count], local.cidr_grid_bits)) - local.cidr_grid_bits,
+        0
+      )
+    ]
+  }
+
+  cidr_grid_unslotted_tier_keys = [for k in local.additional_subnet_tier_keys : k if local.subnet_tiers[k].grid_slot == null]
+
+  cidr_grid_invalid_reasons = local.cidr_grid_enabled ? compact([
+    length(local.cidr_grid_unslotted_tier_keys) > 0 ? format("every additional tier needs a `grid_slot` (missing for %s)", join(", ", local.cidr_grid_unslotted_tier_keys)) : "",
+    anytrue([for v in values(local.subnet_tiers) : coalesce(v.grid_slot, 0) >= var.cidr_grid.tier_slots]) ? "`tier_slots` must be greater than the `grid_slot` of every tier" : "",
+    anytrue([for o in values(local.cidr_grid_az_ordinals) : o == null ? true : o >= var.cidr_grid.az_slots]) ? format("`az_slots` is too small for the Availability Zones %s", join(", ", keys(local.cidr_grid_az_ordinals))) : "",
+    anytrue([for v in values(local.subnet_tiers) : v.enabled && v.subnets_per_az_count > var.cidr_grid.subnet_slots]) ? "`subnet_slots` must be at least the number of subnets per AZ of every tier" : "",
+    anytrue([for n in flatten(values(local.subnet_tier_ipv4_size_newbits)) : n == null ? false : n < local.cidr_grid_bits]) ? format("subnet sizes must not be larger than a cell (`newbits` of at least %d)", local.cidr_grid_bits) : "",
+    anytrue(flatten([for k in local.subnet_tier_keys : [
+      for i, n in local.subnet_tier_ipv4_size_newbits[k] : tonumber(split("/", local.subnet_tier_ipv4_cidr_blocks[k][i])[1]) + max(local.cidr_grid_bits, coalesce(n, local.cidr_grid_bits)) > 28
+    ] if local.subnet_tiers[k].enabled && local.subnet_tiers[k].ipv4_enabled])) ? "subnets must not be smaller than a /28, the smallest subnet AWS allows, so use fewer or larger cells or smaller subnet sizes" : "",
+  ]) : []
 
   ################### End of CIDR configuration #######################
 
+  #########################################
+  # Configure the subnets of the additional tiers
+  #
+  # The subnets of the additional tiers are created with `for_each`, keyed by "<tier>/<AZ>/<subnet name>",
+  # so that adding or removing a tier does not disturb the subnets of the other tiers.
+
+  additional_subnet_tier_dns64_enabled = {
+    for k in local.additional_subnet_tier_keys : k => local.subnet_tiers[k].enabled && local.ipv6_enabled && local.subnet_tiers[k].ipv6_enabled && (
+      local.subnet_tiers[k].egress == "nat" ? (
+        var.private_dns64_nat64_enabled == null ? local.private_dns64_default : var.private_dns64_nat64_enabled
+      ) : local.subnet_tiers[k].egress == "igw" && var.public_dns64_nat64_enabled
+    )
+  }
+
+  # Subnets are listed in the same order as the built-in tiers: by AZ, then by position in `subnets_per_az_names`.
+  additional_tier_subnet_list = flatten([
+    for k in local.additional_subnet_tier_keys : [
+      for az_index, az in local.vpc_availability_zones : [
+        for i, name in local.subnet_tiers[k].subnets_per_az_names : {
+          key               = format("%s/%s", k, local.subnet_tier_subnet_keys[k][az_index * local.subnet_tiers[k].subnets_per_az_count + i])
+          tier              = k
+          name              = name
+          availability_zone = az
+          az_abbreviation   = local.az_abbreviation_map[az]
+          # Only distinguish subnets by name in the Name tag when there is more than one per AZ
+          name_suffix     = local.subnet_tiers[k].subnets_per_az_count > 1 ? name : ""
+          egress          = local.subnet_tiers[k].egress
+          ipv4_enabled    = local.ipv4_enabled && local.subnet_tiers[k].ipv4_enabled
+          ipv6_enabled    = local.ipv6_enabled && local.subnet_tiers[k].ipv6_enabled
+          dns64_enabled   = local.additional_subnet_tier_dns64_enabled[k]
+          ipv4_cidr_block = local.ipv4_enabled && local.subnet_tiers[k].ipv4_enabled ? local.ipv4_subnet_tier_cidrs[k][az_index * local.subnet_tiers[k].subnets_per_az_count + i] : null
+          ipv6_cidr_block = local.ipv6_enabled && local.subnet_tiers[k].ipv6_enabled ? local.ipv6_subnet_tier_cidrs[k][az_index * local.subnet_tiers[k].subnets_per_az_count + i] : null
+          # The NAT device this subnet routes to, chosen the same way as for the private subnets
+          nat_key = local.nat_count > 0 ? local.nat_keys[(az_index * local.nats_per_az + i % local.nats_per_az) % local.nat_count] : null
+        }
+      ]
+    ] if local.e && local.subnet_tiers[k].enabled && (local.subnet_tiers[k].ipv4_enabled || local.subnet_tiers[k].ipv6_enabled)
+  ])
+
+  additional_tier_subnets = { for s in local.additional_tier_subnet_list : s.key => s }
+
+  additional_open_network_acl_tiers = {
+    for k, v in local.additional_subnet_tiers : k => v
+    if local.e && v.enabled && v.open_network_acl_enabled && !contains(local.network_acl_preset_tiers, k) && !contains(local.supplied_network_acl_tiers, k)
+  }
+  additional_network_acl_tiers = {
+    for k, v in local.additional_subnet_tiers : k => v
+    if local.e && v.enabled && (v.open_network_acl_enabled || contains(keys(var.network_acl_rules), k)) && !contains(local.supplied_network_acl_tiers, k)
+  }
+
+  ################### End of additional tier configuration #######################
+
+  #########################################
+  # Configure the Transit Gateway attachment and routes
+
+  transit_gateway_configured         = local.e && length(var.transit_gateway_id) > 0
+  transit_gateway_attachment_enabled = local.transit_gateway_configured && var.transit_gateway_attachment_enabled
+
+  transit_gateway_attachment_subnet_tier = var.transit_gateway_attachment.subnet_tier
+  transit_gateway_attachment_subnet_name = coalesce(
+    var.transit_gateway_attachment.subnet_name,
+    try(local.subnet_tier_key_names[local.transit_gateway_attachment_subnet_tier][0], "")
+  )
+  # One subnet per AZ
+  transit_gateway_attachment_subnet_keys = local.transit_gateway_attachment_enabled ? [
+    for az in local.vpc_availability_zones : format("%s/%s", local.az_key_map[az], local.transit_gateway_attachment_subnet_name)
+  ] : []
+  transit_gateway_attachment_subnets_valid = alltrue([
+    for k in local.transit_gateway_attachment_subnet_keys : contains(keys(try(local.tier_subnet_id_map[local.transit_gateway_attachment_subnet_tier], {})), k)
+  ])
+  transit_gateway_attachment_subnet_ids = [
+    for k in local.transit_gateway_attachment_subnet_keys : local.tier_subnet_id_map[local.transit_gateway_attachment_subnet_tier][k]
+    if local.transit_gateway_attachment_subnets_valid
+  ]
+  transit_gateway_attachment_ipv6_support = coalesce(
+    var.transit_gateway_attachment.ipv6_support,
+    local.ipv6_enabled && try(local.subnet_tiers[local.transit_gateway_attachment_subnet_tier].ipv6_enabled, false)
+  )
+
+  # In centralized egress mode, the tiers that would otherwise egress through a NAT device route to the Transit Gateway.
+  # These routes are generated even without a Transit Gateway so that the precondition on the routes can report it.
+  centralized_egress_enabled  = local.e && var.centralized_egress.enabled
+  centralized_egress6_enabled = local.centralized_egress_enabled && var.centralized_egress.ipv6_enabled
+  centralized_egress_tier_routes = {
+    for k in local.subnet_tier_keys : k => {
+      ipv4_cidrs = local.ipv4_enabled && local.subnet_tiers[k].ipv4_enabled ? ["0.0.0.0/0"] : []
+      ipv6_cidrs = concat(
+        local.centralized_egress6_enabled && local.ipv6_enabled && local.subnet_tiers[k].ipv6_enabled ? ["::/0"] : [],
+        var.centralized_egress.nat64 == "transit_gateway" && lookup(local.additional_subnet_tier_dns64_enabled, k, local.private_dns64_enabled) ? [local.nat64_cidr] : [],
+      )
+      prefix_list_ids = []
+    } if local.centralized_egress_enabled && local.subnet_tiers[k].egress == "nat"
+  }
+
+  # A route to each destination in each route table of the tier, keyed by "<tier>/<route table key>/<destination>".
+  # `distinct` drops a default route listed in `transit_gateway_routes` that centralized egress also adds.
+  # A tier that does not exist gets a single "invalid" route table, so that the precondition on the routes reports it.
+  transit_gateway_route_invalid_tiers = [
+    for tier in keys(var.transit_gateway_routes) : tier if local.transit_gateway_configured && !contains(keys(local.tier_route_table_keys), tier)
+  ]
+  transit_gateway_route_sets = concat(
+    [for tier, r in var.transit_gateway_routes : { tier = tier, routes = r } if local.transit_gateway_configured],
+    [for tier, r in local.centralized_egress_tier_routes : { tier = tier, routes = r }],
+  )
+  transit_gateway_route_list = distinct(flatten([
+    for rs in local.transit_gateway_route_sets : [
+      for rt in lookup(local.tier_route_table_keys, rs.tier, ["invalid"]) : concat(
+        [for d in rs.routes.ipv4_cidrs : { tier = rs.tier, route_table_key = rt, destination = d, ipv4_cidr = d, ipv6_cidr = null, prefix_list_id = null }],
+        [for d in rs.routes.ipv6_cidrs : { tier = rs.tier, route_table_key = rt, destination = d, ipv4_cidr = null, ipv6_cidr = d, prefix_list_id = null }],
+        [for d in rs.routes.prefix_list_ids : { tier = rs.tier, route_table_key = rt, destination = d, ipv4_cidr = null, ipv6_cidr = null, prefix_list_id = d }],
+      )
+    ]
+  ]))
+
+  transit_gateway_routes = { for r in local.transit_gateway_route_list : format("%s/%s/%s", r.tier, r.route_table_key, r.destination) => r }
+
+  ################### End of Transit Gateway configuration #######################
+
+  #########################################
+  # Configure the additional routes
+
+  # The key names (see `subnet_tier_key_names`) of the subnets that each additional route is limited to
+  additional_route_subnet_key_names = { for name, r in var.additional_routes : name => flatten([
+    for n in coalesce(r.subnet_names, []) : [
+      for i, kn in try(local.subnet_tier_key_names[r.subnet_tier], []) : kn if local.subnet_tiers[r.subnet_tier].subnets_per_az_names[i] == n
+    ]
+  ]) if local.e }
+  additional_route_errors = { for name, r in var.additional_routes : name => concat(
+    contains(keys(local.tier_route_table_keys), r.subnet_tier) ? [] : [format("`%s`: unknown subnet tier `%s`", name, r.subnet_tier)],
+    [
+      for n in coalesce(r.subnet_names, []) : format("`%s`: no `%s` subnet named `%s`", name, r.subnet_tier, n)
+      if !contains(try(local.subnet_tiers[r.subnet_tier].subnets_per_az_names, []), n)
+    ],
+  ) if local.e }
+
+  # Like the IGW routes, additional public routes also go in the route tables supplied in `public_route_table_ids`.
+  additional_route_table_keys = merge(local.tier_route_table_keys, { public = local.public_route_table_keys })
+  additional_route_table_id_map = merge(local.tier_route_table_id_map, {
+    public = { for k, i in local.public_route_table_key_to_index_map : k => local.public_route_table_ids[i] }
+  })
+
+  # A route for each route table of the tier, keyed by "<name>/<route table key>".
+  # A shared public route table serves every subnet name, and a supplied one is not associated with a name.
+  # A route whose tier or subnet names do not exist gets a single "<name>/invalid" entry instead,
+  # so that the precondition on the routes reports it rather than the route being dropped.
+  additional_routes = { for r in flatten([
+    for name, r in var.additional_routes : length(local.additional_route_errors[name]) > 0 ? [
+      merge(r, { name = name, route_table_key = "invalid" })
+      ] : [
+      for rt in local.additional_route_table_keys[r.subnet_tier] : merge(r, { name = name, route_table_key = rt })
+      if r.subnet_names == null || rt == "shared" || contains(local.additional_route_subnet_key_names[name], try(split("/", rt)[1], ""))
+    ] if local.e
+  ]) : format("%s/%s", r.name, r.route_table_key) => r }
+
+  ################### End of additional route configuration #######################
+
+  #########################################
+  # Configure the VPC endpoints
+
+  vpc_endpoints_enabled = local.e && length(var.gateway_vpc_endpoints) + length(var.interface_vpc_endpoints) > 0
+
+  # `region` replaces the deprecated `name` in version 6 of the AWS provider. Referring to the attributes through
+  # the loop variable defers the check for `region` to plan time, where `try` can fall back to `name` on version 5.
+  vpc_endpoint_region = one([for r in data.aws_region.current : try(r.region, r.name)])
+
+  gateway_vpc_endpoints = { for k, v in var.gateway_vpc_endpoints : k => merge(v, {
+    service_name      = coalesce(v.service_name, format("com.amazonaws.%s.%s", local.vpc_endpoint_region, k))
+    route_table_tiers = v.route_table_tiers == null ? (length(v.subnet_names) == 0 ? ["private"] : []) : v.route_table_tiers
+  }) if local.e }
+
+  # The route tables of the listed tiers, plus those of the listed named subnets
+  gateway_vpc_endpoint_route_table_ids = { for k, v in local.gateway_vpc_endpoints : k => distinct(concat(
+    flatten([for t in v.route_table_tiers : try(local.tier_route_table_ids[t], [])]),
+    flatten([for t, names in v.subnet_names : [for n in names : try(local.named_tier_route_table_ids_map[t][n], [])]]),
+  )) }
+  gateway_vpc_endpoint_errors = { for k, v in local.gateway_vpc_endpoints : k => concat(
+    [for t in v.route_table_tiers : format("unknown subnet tier `%s`", t) if !contains(keys(local.tier_route_table_ids), t)],
+    flatten([for t, names in v.subnet_names : [
+      for n in names : format("no `%s` subnet named `%s`", t, n) if !contains(keys(try(local.named_tier_route_table_ids_map[t], {})), n)
+    ]]),
+  ) }
+
+
+  interface_vpc_endpoints = { for k, v in var.interface_vpc_endpoints : k => merge(v, {
+    service_name = coalesce(v.service_name, format("com.amazonaws.%s.%s", local.vpc_endpoint_region, k))
+  }) if local.e }
+  interface_vpc_endpoints_enabled = length(local.interface_vpc_endpoints) > 0
+
+  # One subnet per AZ
+  interface_vpc_endpoint_subnet_name = coalesce(var.interface_vpc_endpoint_subnet_name, try(local.private_subnets_per_az_names[0], ""))
+  interface_vpc_endpoint_subnet_keys = local.interface_vpc_endpoints_enabled ? [
+    for az in local.vpc_availability_zones : format("%s/%s", local.az_key_map[az], local.interface_vpc_endpoint_subnet_name)
+  ] : []
+  interface_vpc_endpoint_subnets_valid = alltrue([
+    for k in local.interface_vpc_endpoint_subnet_keys : contains(keys(local.private_subnet_key_to_index_map), k)
+  ])
+  interface_vpc_endpoint_subnet_ids = [
+    for k in local.interface_vpc_endpoint_subnet_keys : aws_subnet.private[k].id if local.interface_vpc_endpoint_subnets_valid
+  ]
+
+  interface_vpc_endpoint_security_group_enabled = local.interface_vpc_endpoints_enabled && var.interface_vpc_endpoint_security_group.enabled
+  interface_vpc_endpoint_allowed_tiers          = var.interface_vpc_endpoint_security_group.allowed_subnet_tiers
+  interface_vpc_endpoint_invalid_tiers = [
+    for t in coalesce(local.interface_vpc_endpoint_allowed_tiers, []) : t if !contains(keys(local.tier_subnet_cidrs), t)
+  ]
+  # The ingress rules are keyed by where the traffic comes from, which is known when planning even when
+  # the CIDRs are not, such as subnet CIDRs allocated from IPAM: "vpc", each subnet of the allowed tiers
+  # (e.g. "private/use2a/app"), and "allowed" for `allowed_ipv4_cidrs` and `allowed_ipv6_cidrs`
+  interface_vpc_endpoint_ingress_rules = local.interface_vpc_endpoint_security_group_enabled ? merge(
+    local.interface_vpc_endpoint_allowed_tiers == null ? (local.ipv4_enabled || local.ipv6_enabled ? {
+      vpc = {
+        cidr_blocks = local.ipv4_enabled ? local.vpc_ingress_ipv4_cidrs : []
+        ipv6_cidr_blocks = local.ipv6_enabled ? (
+          local.base_ipv6_cidr_block != "" ? [local.base_ipv6_cidr_block] : flatten(values(local.tier_subnet_ipv6_cidrs))
+        ) : []
+      }
+    } : {}) : {},
+    merge([for t in coalesce(local.interface_vpc_endpoint_allowed_tiers, []) : {
+      for k in local.subnet_tier_subnet_keys[t] : format("%s/%s", t, k) => {
+        cidr_blocks      = local.ipv4_enabled && local.subnet_tiers[t].ipv4_enabled ? [local.tier_subnet_map[t][k].cidr_block] : []
+        ipv6_cidr_blocks = local.ipv6_enabled && local.subnet_tiers[t].ipv6_enabled ? [local.tier_subnet_map[t][k].ipv6_cidr_block] : []
+      } if local.ipv4_enabled && local.subnet_tiers[t].ipv4_enabled || local.ipv6_enabled && local.subnet_tiers[t].ipv6_enabled
+    } if contains(keys(local.subnet_tier_subnet_keys), t)]...),
+    length(var.interface_vpc_endpoint_security_group.allowed_ipv4_cidrs) + length(var.interface_vpc_endpoint_security_group.allowed_ipv6_cidrs) > 0 ? {
+      allowed = {
+        cidr_blocks      = var.interface_vpc_endpoint_security_group.allowed_ipv4_cidrs
+        ipv6_cidr_blocks = var.interface_vpc_endpoint_security_group.allowed_ipv6_cidrs
+      }
+    } : {},
+  ) : {}
+
+  ################### End of VPC endpoint configuration #######################
+
+  #########################################
+  # Configure the private NAT Gateways
+  #
+  # Private NAT Gateways go in the private subnets named by `private_nat_gateway.subnet_name`, one per AZ up to `max_nats`.
+  # The route tables of `private_nat_gateway.subnet_tiers` route the destinations to them, each to the one in its own AZ.
+
+  private_nat_gateway_enabled     = local.private4_enabled && var.private_nat_gateway.enabled
+  private_nat_gateway_subnet_name = coalesce(var.private_nat_gateway.subnet_name, try(local.private_subnets_per_az_names[0], ""))
+  private_nat_gateway_azs         = local.private_nat_gateway_enabled ? slice(local.vpc_availability_zones, 0, min(local.vpc_az_count, var.max_nats)) : []
+  private_nat_gateway_keys        = [for az in local.private_nat_gateway_azs : format("%s/%s", local.az_key_map[az], local.private_nat_gateway_subnet_name)]
+  private_nat_gateway_subnets_valid = alltrue([
+    for k in local.private_nat_gateway_keys : contains(keys(local.private_subnet_key_to_index_map), k)
+  ])
+  private_nat_gateway_invalid_tiers = [
+    for k in var.private_nat_gateway.subnet_tiers : k if !contains(local.subnet_tier_keys, k) || k == "public"
+  ]
+
+  # As in `private_route_table_to_nat_map`, with one NAT Gateway per AZ: the route tables of each tier are in AZ order,
+  # `subnets_per_az_count` per AZ, and wrap around to the first NAT Gateways when `max_nats` limits them to fewer AZs.
+  # The route tables of the subnets the NAT Gateways go in are skipped, since routing them to a NAT Gateway would loop.
+  private_nat_gateway_routes = { for r in flatten([
+    for k in var.private_nat_gateway.subnet_tiers : [
+      for i, rt in local.tier_route_table_keys[k] : [
+        for d in concat(
+          [for c in var.private_nat_gateway.destination_cidrs : { destination = c, cidr_block = c, prefix_list_id = null }],
+          [for pl in var.private_nat_gateway.destination_prefix_list_ids : { destination = pl, cidr_block = null, prefix_list_id = pl }],
+          ) : merge(d, {
+            tier            = k
+            route_table_key = rt
+            nat_key         = local.private_nat_gateway_keys[floor(i / local.subnet_tiers[k].subnets_per_az_count) % length(local.private_nat_gateway_keys)]
+        })
+      ] if !(k == "private" && element(split("/", rt), 1) == local.private_nat_gateway_subnet_name)
+    ] if local.private_nat_gateway_enabled && local.private_nat_gateway_subnets_valid && !contains(local.private_nat_gateway_invalid_tiers, k)
+  ]) : format("%s/%s/%s", r.tier, r.route_table_key, r.destination) => r }
+
+  ################### End of private NAT Gateway configuration #######################
+
   ##########################################
   # Tick off the list of things to create
 
-  public_enabled  = local.e && var.public_subnets_enabled
-  private_enabled = local.e && var.private_subnets_enabled
-  ipv4_enabled    = local.e && var.ipv4_enabled
-  ipv6_enabled    = local.e && var.ipv6_enabled
+  public_enabled  = local.e && local.subnet_tiers.public.enabled
+  private_enabled = local.e && local.subnet_tiers.private.enabled
+  intra_enabled   = local.e && local.subnet_tiers.intra.enabled
+  ipv4_enabled    = local.e && anytrue([for v in values(local.subnet_tiers) : v.enabled && v.ipv4_enabled])
+  ipv6_enabled    = local.e && anytrue([for v in values(local.subnet_tiers) : v.enabled && v.ipv6_enabled])
 
   igw_configured = length(var.igw_id) > 0
   # ipv6_egress_only_configured indicates if the configuration *supports* the use of
   # an IPv6 Egress-only Internet Gateway, not if it *requires* its use.
   ipv6_egress_only_configured = local.ipv6_enabled && length(var.ipv6_egress_only_igw_id) > 0
 
-  public4_enabled  = local.public_enabled && local.ipv4_enabled
-  public6_enabled  = local.public_enabled && local.ipv6_enabled
-  private4_enabled = local.private_enabled && local.ipv4_enabled
-  private6_enabled = local.private_enabled && local.ipv6_enabled
+  public4_enabled  = local.public_enabled && local.subnet_tiers.public.ipv4_enabled
+  public6_enabled  = local.public_enabled && local.subnet_tiers.public.ipv6_enabled
+  private4_enabled = local.private_enabled && local.subnet_tiers.private.ipv4_enabled
+  private6_enabled = local.private_enabled && local.subnet_tiers.private.ipv6_enabled
+  intra4_enabled   = local.intra_enabled && local.subnet_tiers.intra.ipv4_enabled
+  intra6_enabled   = local.intra_enabled && local.subnet_tiers.intra.ipv6_enabled
 
   public_dns64_enabled = local.public6_enabled && var.public_dns64_nat64_enabled
   # Set the default for private_dns64_enabled to true unless there is no IPv4 egress to enable it.
+  # With centralized egress, NAT64 is done by the egress VPC, by local NAT Gateways, or not at all.
+  private_dns64_default = local.centralized_egress_enabled ? (
+    var.centralized_egress.nat64 == "transit_gateway" || (var.centralized_egress.nat64 == "nat_gateway" && local.public4_enabled)
+  ) : local.public4_enabled
   private_dns64_enabled = local.private6_enabled && (
-    var.private_dns64_nat64_enabled == null ? local.public4_enabled : var.private_dns64_nat64_enabled
+    var.private_dns64_nat64_enabled == null ? local.private_dns64_default : var.private_dns64_nat64_enabled
   )
+  # Whether the private (NAT egress) subnets send NAT64 traffic to a NAT Gateway in this VPC
+  private_nat64_nat_gateway_enabled = !local.centralized_egress_enabled || var.centralized_egress.nat64 == "nat_gateway"
+  # Whether the private (NAT egress) subnets send IPv6 traffic to the Egress-only Internet Gateway
+  private_egress_only6_enabled = local.ipv6_egress_only_configured && !local.centralized_egress6_enabled
 
   public_route_table_enabled = local.public_enabled && var.public_route_table_enabled
 
@@ -183,22 +820,301 @@ locals {
   )
 
   create_public_route_tables = local.public_route_table_enabled && length(var.public_route_table_ids) == 0
-  public_route_table_ids     = local.create_public_route_tables ? aws_route_table.public[*].id : var.public_route_table_ids
 
-  private_route_table_enabled = local.private_enabled && var.private_route_table_enabled
-  private_route_table_count   = local.private_route_table_enabled ? local.private_subnet_az_count : 0
-  private_route_table_ids     = local.private_route_table_enabled ? aws_route_table.private[*].id : []
+  # Public route tables are keyed like the subnets they serve, or "shared" when one table serves every public subnet.
+  # Supplied route tables are keyed by their position in `public_route_table_ids`.
+  public_route_table_per_subnet = var.public_route_table_per_subnet_enabled == null ? local.public_dns64_enabled : var.public_route_table_per_subnet_enabled
+  public_route_table_keys = local.public_route_table_count == 0 ? [] : length(var.public_route_table_ids) > 0 ? [
+    for i in range(local.public_route_table_count) : tostring(i)
+  ] : local.public_route_table_per_subnet ? local.public_subnet_keys : ["shared"]
+  public_route_table_key_to_index_map = { for i, k in local.public_route_table_keys : k => i }
+  public_route_table_ids = local.create_public_route_tables ? [
+    for k in local.public_route_table_keys : aws_route_table.public[k].id
+  ] : var.public_route_table_ids
+
+  private_route_table_enabled          = local.private_enabled && var.private_route_table_enabled
+  private_route_table_count            = local.private_route_table_enabled ? local.private_subnet_az_count : 0
+  private_route_table_keys             = local.private_route_table_enabled ? local.private_subnet_keys : []
+  private_route_table_key_to_index_map = { for i, k in local.private_route_table_keys : k => i }
+  private_route_table_ids              = [for k in local.private_route_table_keys : aws_route_table.private[k].id]
+
+  # Intra subnets always get their own route tables, which only ever have the VPC local routes
+  intra_route_table_ids = [for k in local.intra_subnet_keys : aws_route_table.intra[k].id]
+
+  created_public_route_table_keys = local.create_public_route_tables ? local.public_route_table_keys : []
+
+  # The subnets and the route tables created for each tier, built-in or additional, mapped from their key within
+  # the tier (e.g. "use2a/app") to their ID, for features that apply to chosen tiers
+  tier_subnet_map = merge(
+    { for k in local.additional_subnet_tier_keys : k => {
+      for s in local.additional_tier_subnet_list : trimprefix(s.key, format("%s/", k)) => aws_subnet.tier[s.key] if s.tier == k
+    } },
+    {
+      private = { for k in local.private_subnet_keys : k => aws_subnet.private[k] }
+      public  = { for k in local.public_subnet_keys : k => aws_subnet.public[k] }
+      intra   = { for k in local.intra_subnet_keys : k => aws_subnet.intra[k] }
+    }
+  )
+
+  tier_subnet_id_map = { for t, subnets in local.tier_subnet_map : t => { for k, s in subnets : k => s.id } }
+  tier_route_table_id_map = merge(
+    { for k in local.additional_subnet_tier_keys : k => {
+      for s in local.additional_tier_subnet_list : trimprefix(s.key, format("%s/", k)) => aws_route_table.tier[s.key].id if s.tier == k
+    } },
+    {
+      private = { for k in local.private_route_table_keys : k => aws_route_table.private[k].id }
+      public  = { for k in local.created_public_route_table_keys : k => aws_route_table.public[k].id }
+      intra   = { for k in local.intra_subnet_keys : k => aws_route_table.intra[k].id }
+    }
+  )
+
+  # The keys of the maps above, which are known at plan time even when the IDs are not
+  tier_route_table_keys = merge(
+    { for k in local.additional_subnet_tier_keys : k => [
+      for s in local.additional_tier_subnet_list : trimprefix(s.key, format("%s/", k)) if s.tier == k
+    ] },
+    {
+      private = local.private_route_table_keys
+      public  = local.created_public_route_table_keys
+      intra   = local.intra_subnet_keys
+    }
+  )
 
   # public and private network ACLs
   # Support deprecated var.public_network_acl_id
-  public_open_network_acl_enabled = local.public_enabled && var.public_open_network_acl_enabled
+  public_open_network_acl_enabled = (
+    local.public_enabled && local.subnet_tiers.public.open_network_acl_enabled && !contains(local.network_acl_preset_tiers, "public") && !contains(local.supplied_network_acl_tiers, "public")
+  )
   # Support deprecated var.private_network_acl_id
-  private_open_network_acl_enabled = local.private_enabled && var.private_open_network_acl_enabled
+  private_open_network_acl_enabled = (
+    local.private_enabled && local.subnet_tiers.private.open_network_acl_enabled && !contains(local.network_acl_preset_tiers, "private") && !contains(local.supplied_network_acl_tiers, "private")
+  )
+  intra_open_network_acl_enabled = (
+    local.intra_enabled && local.subnet_tiers.intra.open_network_acl_enabled && !contains(local.network_acl_preset_tiers, "intra") && !contains(local.supplied_network_acl_tiers, "intra")
+  )
+  # A tier with `network_acl_rules` gets a network ACL even without the open rules, unless its network ACLs are supplied
+  public_network_acl_enabled = local.public_open_network_acl_enabled || (
+    local.public_enabled && contains(keys(var.network_acl_rules), "public") && !contains(local.supplied_network_acl_tiers, "public")
+  )
+  private_network_acl_enabled = local.private_open_network_acl_enabled || (
+    local.private_enabled && contains(keys(var.network_acl_rules), "private") && !contains(local.supplied_network_acl_tiers, "private")
+  )
+  intra_network_acl_enabled = local.intra_open_network_acl_enabled || (
+    local.intra_enabled && contains(keys(var.network_acl_rules), "intra") && !contains(local.supplied_network_acl_tiers, "intra")
+  )
+
+  # The subnets with a network ACL of their own, from `named_network_acl_rules`, keyed by "<tier>/<subnet name>".
+  # These subnets are left out of the network ACL of their tier.
+  named_network_acls = { for a in flatten([
+    for tier, names in var.named_network_acl_rules : [
+      for name, v in names : {
+        key  = format("%s/%s", tier, name)
+        tier = tier
+        name = name
+        subnet_keys = [
+          for i, sk in local.subnet_tier_subnet_keys[tier] : sk
+          if local.subnet_tiers[tier].subnets_per_az_names[i % local.subnet_tiers[tier].subnets_per_az_count] == name
+        ]
+      }
+    ] if local.e && try(local.subnet_tiers[tier].enabled, false)
+  ]) : a.key => a }
+  named_network_acl_subnet_keys = {
+    for k in local.subnet_tier_keys : k => flatten([for a in values(merge(local.named_network_acls, local.named_supplied_network_acls)) : a.subnet_keys if a.tier == k])
+  }
+
+  # The subnets associated with existing network ACLs, from `named_network_acl_ids`, `public_network_acl_ids`
+  # and `private_network_acl_ids`, keyed by "<tier>/<subnet key>". Named subnets take precedence over their tier.
+  named_supplied_network_acls = { for a in flatten([
+    for tier, names in var.named_network_acl_ids : [
+      for name, id in names : {
+        key            = format("%s/%s", tier, name)
+        tier           = tier
+        network_acl_id = id
+        subnet_keys = [
+          for i, sk in local.subnet_tier_subnet_keys[tier] : sk
+          if local.subnet_tiers[tier].subnets_per_az_names[i % local.subnet_tiers[tier].subnets_per_az_count] == name
+        ]
+      }
+    ] if local.e && try(local.subnet_tiers[tier].enabled, false)
+  ]) : a.key => a }
+  named_supplied_network_acl_invalid_tiers = [for tier in keys(var.named_network_acl_ids) : tier if local.e && !contains(local.subnet_tier_keys, tier)]
+  supplied_tier_network_acl_ids = {
+    for k, v in { public = var.public_network_acl_ids, private = var.private_network_acl_ids } : k => v if length(v) > 0 && local.e && local.subnet_tiers[k].enabled
+  }
+  # The tiers that need no network ACL of their own, because every one of their subnets uses a supplied network ACL
+  supplied_network_acl_tiers = [
+    for k in local.subnet_tier_keys : k if contains(keys(local.supplied_tier_network_acl_ids), k) || (
+      length(local.subnet_tier_subnet_keys[k]) > 0 && length(setsubtract(
+        local.subnet_tier_subnet_keys[k], flatten([for v in values(local.named_supplied_network_acls) : v.subnet_keys if v.tier == k])
+      )) == 0
+    )
+  ]
+  supplied_network_acl_associations = merge(
+    { for a in flatten([
+      for k, ids in local.supplied_tier_network_acl_ids : [
+        for i, sk in local.subnet_tier_subnet_keys[k] : { tier = k, subnet_key = sk, network_acl_id = element(ids, i) }
+        if !contains(local.named_network_acl_subnet_keys[k], sk)
+      ]
+    ]) : format("%s/%s", a.tier, a.subnet_key) => a },
+    { for a in flatten([
+      for v in values(local.named_supplied_network_acls) : [for sk in v.subnet_keys : { tier = v.tier, subnet_key = sk, network_acl_id = v.network_acl_id }]
+    ]) : format("%s/%s", a.tier, a.subnet_key) => a },
+    # The unknown tiers are kept, without a subnet, so that the precondition reports them
+    { for tier in local.named_supplied_network_acl_invalid_tiers : tier => { tier = tier, subnet_key = "", network_acl_id = "" } },
+  )
+  supplied_network_acl_errors = concat(
+    [
+      for k, ids in local.supplied_tier_network_acl_ids : format("`%s_network_acl_ids` must have 1 or %d elements, not %d.", k, length(local.subnet_tier_subnet_keys[k]), length(ids))
+      if length(ids) != 1 && length(ids) != length(local.subnet_tier_subnet_keys[k])
+    ],
+    [for k, v in local.named_supplied_network_acls : format("`named_network_acl_ids` lists `%s`, but the `%s` tier has no subnets with that name.", k, v.tier) if length(v.subnet_keys) == 0],
+    [for tier in local.named_supplied_network_acl_invalid_tiers : format("`named_network_acl_ids` has the unknown subnet tier `%s`. Use `private`, `public`, `intra`, or a key of `subnet_tiers`.", tier)],
+  )
+
+  # The label of each tier, for naming the network ACLs of its named subnets
+  tier_label_ids = merge(
+    { for k, v in module.tier_label : k => v.id },
+    { private = module.private_label.id, public = module.public_label.id, intra = module.intra_label.id }
+  )
+  tier_label_tags = merge(
+    { for k, v in module.tier_label : k => v.tags },
+    { private = module.private_label.tags, public = module.public_label.tags, intra = module.intra_label.tags }
+  )
+
+  # The network ACLs that rules can be added to: those of the tiers, and those of the named subnets
+  network_acl_id_map = merge(local.tier_network_acl_ids, { for k, v in aws_network_acl.named : k => v.id })
+
+  # The rules of `network_acl_rules` and `named_network_acl_rules`, keyed by "<tier>/<ingress|egress>/<rule number>"
+  # or "<tier>/<subnet name>/<ingress|egress>/<rule number>".
+  # The rules of a tier that is not enabled are ignored. The rules of an unknown tier are kept, without a network ACL,
+  # so that the precondition on the rules reports the tier.
+  network_acl_rule_invalid_tiers = [
+    for tier in distinct(concat(keys(var.network_acl_rules), keys(var.named_network_acl_rules))) : tier
+    if local.e && !contains(local.subnet_tier_keys, tier)
+  ]
+  network_acl_rule_sets = [for rs in concat(
+    [for tier, v in var.network_acl_rules : { acl = tier, tier = tier, open = true, rules = v } if local.e && try(local.subnet_tiers[tier].enabled, true)],
+    flatten([for tier, names in var.named_network_acl_rules : [
+      for name, v in names : { acl = format("%s/%s", tier, name), tier = tier, open = false, rules = v }
+    ] if local.e && try(local.subnet_tiers[tier].enabled, true)]),
+    ) : merge(rs, {
+      ipv4_enabled = local.ipv4_enabled && try(local.subnet_tiers[rs.tier].ipv4_enabled, true)
+      ipv6_enabled = local.ipv6_enabled && try(local.subnet_tiers[rs.tier].ipv6_enabled, true)
+  })]
+  network_acl_listed_rules = flatten([
+    for rs in local.network_acl_rule_sets : [
+      for d in ["ingress", "egress"] : [
+        for rule in rs.rules[d] : merge(rule, {
+          acl    = rs.acl
+          egress = d == "egress"
+          key    = format("%s/%s/%d", rs.acl, d, rule.rule_number)
+          # The open rule with this number, if it is created in this network ACL
+          open_rule_collision = rs.open && try(local.subnet_tiers[rs.tier].open_network_acl_enabled, false) && !contains(local.network_acl_preset_tiers, rs.tier) && (
+            (rs.ipv4_enabled && rule.rule_number == var.open_network_acl_ipv4_rule_number) ||
+            (rs.ipv6_enabled && rule.rule_number == var.open_network_acl_ipv6_rule_number)
+          )
+        })
+      ]
+    ]
+  ])
+
+  # The tiers whose network ACL is generated from a preset, which replaces the open rules
+  network_acl_preset_tiers = [for k, v in var.network_acl_rules : k if v.preset != null]
+
+  # The sources the presets trust: the CIDR blocks the module's subnets are in, or the subnet CIDRs themselves
+  # when there is no base CIDR block. Unlike `ipv4_cidr_blocks_in_use`, the number of CIDRs is known at plan time
+  # even when the base CIDR block is not, e.g. when the VPC is created in the same plan, since it sets the number of rules.
+  network_acl_trusted_ipv4_cidrs = local.ipv4_enabled ? (length(var.ipv4_cidr_block) > 0 || local.need_vpc_data ? concat(
+    [local.base_ipv4_cidr_block],
+    distinct(flatten([
+      for v in values(local.subnet_tiers) : concat(v.ipv4_cidr_block == null ? [] : [v.ipv4_cidr_block], values(v.subnet_ipv4_cidr_blocks)) if v.enabled && v.ipv4_enabled
+    ]))
+  ) : flatten(values(local.ipv4_subnet_tier_cidrs))) : []
+  network_acl_trusted_ipv6_cidrs = local.ipv6_enabled ? (
+    length(var.ipv6_cidr_block) > 0 || local.need_vpc_data ? [local.base_ipv6_cidr_block] : flatten(values(local.ipv6_subnet_tier_cidrs))
+  ) : []
+
+  # The trusted sources of each network ACL with a preset that trusts them
+  network_acl_preset_trusted_sources = {
+    for rs in local.network_acl_rule_sets : rs.acl => concat(
+      [for cidr in concat(local.network_acl_trusted_ipv4_cidrs, rs.rules.trusted_ipv4_cidrs) : { cidr_block = cidr, ipv6_cidr_block = null } if rs.ipv4_enabled],
+      [for cidr in concat(local.network_acl_trusted_ipv6_cidrs, rs.rules.trusted_ipv6_cidrs) : { cidr_block = null, ipv6_cidr_block = cidr } if rs.ipv6_enabled],
+    ) if rs.rules.preset != null && rs.rules.preset != "open"
+  }
+
+  # The rules generated from the presets. Each kind of rule has its own block of 100 rule numbers,
+  # so that adding a trusted CIDR does not renumber, and so replace, the other rules.
+  # More than 100 trusted sources would run into the next block, which is reported by a precondition,
+  # and until then the sources after the first 100 are left out so that the rule numbers stay unique.
+  network_acl_preset_rule_block_size = 100
+  network_acl_preset_trusted_overflow = [
+    for acl, sources in local.network_acl_preset_trusted_sources : acl if length(sources) > local.network_acl_preset_rule_block_size
+  ]
+  network_acl_hardened_presets = ["hardened-public", "hardened-private"]
+  network_acl_preset_rules = flatten([
+    for rs in local.network_acl_rule_sets : [
+      for r in concat(
+        # Allow all traffic from the trusted sources
+        [for i, c in try(local.network_acl_preset_trusted_sources[rs.acl], []) : merge(c, {
+          rule_number = 1000 + i, egress = false, rule_action = "allow", protocol = "-1", from_port = 0, to_port = 0
+        }) if i < local.network_acl_preset_rule_block_size],
+        # Deny the remote administration ports from everywhere else
+        [for i, x in setproduct(local.network_acl_preset_anywhere[rs.acl], [22, 3389]) : merge(x[0], {
+          rule_number = 1100 + i, egress = false, rule_action = "deny", protocol = "tcp", from_port = x[1], to_port = x[1]
+        }) if rs.rules.preset != "open"],
+        # Allow the ICMP messages Path MTU Discovery needs: "fragmentation needed" and "packet too big"
+        [for i, x in local.network_acl_preset_anywhere[rs.acl] : merge(x, {
+          rule_number = 1200 + i, egress = false, rule_action = "allow", protocol = x.cidr_block == null ? "58" : "1", from_port = 0, to_port = 0,
+          icmp_type   = x.cidr_block == null ? 2 : 3, icmp_code = x.cidr_block == null ? 0 : 4
+        }) if contains(local.network_acl_hardened_presets, rs.rules.preset)],
+        # Allow HTTP and HTTPS
+        [for i, x in setproduct(local.network_acl_preset_anywhere[rs.acl], [80, 443]) : merge(x[0], {
+          rule_number = 1300 + i, egress = false, rule_action = "allow", protocol = "tcp", from_port = x[1], to_port = x[1]
+        }) if rs.rules.preset == "hardened-public"],
+        # Allow return traffic to the ephemeral ports
+        [for i, x in setproduct(local.network_acl_preset_anywhere[rs.acl], ["tcp", "udp"]) : merge(x[0], {
+          rule_number = 1400 + i, egress = false, rule_action = "allow", protocol = x[1], from_port = 1024, to_port = 65535
+        }) if contains(local.network_acl_hardened_presets, rs.rules.preset)],
+        # Allow everything else
+        [for i, x in local.network_acl_preset_anywhere[rs.acl] : merge(x, {
+          rule_number = 1500 + i, egress = false, rule_action = "allow", protocol = "-1", from_port = 0, to_port = 0
+        }) if !contains(local.network_acl_hardened_presets, rs.rules.preset)],
+        [for i, x in local.network_acl_preset_anywhere[rs.acl] : merge(x, {
+          rule_number = 1500 + i, egress = true, rule_action = "allow", protocol = "-1", from_port = 0, to_port = 0
+        })],
+        ) : merge({ icmp_type = null, icmp_code = null }, r, {
+          acl                 = rs.acl
+          key                 = format("%s/%s/%d", rs.acl, r.egress ? "egress" : "ingress", r.rule_number)
+          open_rule_collision = false
+      })
+    ] if rs.rules.preset != null
+  ])
+  network_acl_preset_anywhere = { for rs in local.network_acl_rule_sets : rs.acl => concat(
+    rs.ipv4_enabled ? [{ cidr_block = "0.0.0.0/0", ipv6_cidr_block = null }] : [],
+    rs.ipv6_enabled ? [{ cidr_block = null, ipv6_cidr_block = "::/0" }] : [],
+  ) }
+
+  # Listed rules take the place of preset rules with the same number
+  network_acl_rules = { for r in concat(local.network_acl_listed_rules, [
+    for r in local.network_acl_preset_rules : r if !contains(local.network_acl_listed_rules[*].key, r.key)
+  ]) : r.key => r }
 
   # A NAT device is needed to NAT from private IPv4 to public IPv4 or to perform NAT64 for IPv6.
-  # An AWS NAT instance does not perform NAT64, and we choose not to try to support NAT64 via NAT instances at this time.
-  nat_instance_useful = local.private4_enabled
-  nat_gateway_useful  = local.nat_instance_useful || local.public_dns64_enabled || local.private_dns64_enabled
+  # An AWS NAT instance only performs NAT64 for the NAT egress subnets, and only when `nat_instance_nat64_enabled` is set.
+  additional_nat4_enabled = local.ipv4_enabled && anytrue([
+    for k in local.additional_subnet_tier_keys : local.subnet_tiers[k].enabled && local.subnet_tiers[k].egress == "nat" && local.subnet_tiers[k].ipv4_enabled
+  ])
+  nat64_via_nat_instance_useful = var.nat_instance_nat64_enabled && anytrue([
+    for k, v in merge(local.additional_subnet_tier_dns64_enabled, { private = local.private_dns64_enabled }) : v && local.subnet_tiers[k].egress == "nat"
+  ])
+  # With centralized egress, IPv4 egress goes through the Transit Gateway, and NAT is only needed for NAT64.
+  nat_instance_useful = !local.centralized_egress_enabled && (local.private4_enabled || local.additional_nat4_enabled || local.nat64_via_nat_instance_useful)
+  nat_gateway_useful = local.nat_instance_useful || local.public_dns64_enabled || anytrue([
+    for k, v in merge(local.additional_subnet_tier_dns64_enabled, { private = local.private_dns64_enabled }) :
+    v && (local.subnet_tiers[k].egress == "igw" || local.private_nat64_nat_gateway_enabled)
+  ])
+  # Whether NAT egress subnets route IPv4 traffic to the NAT Gateways
+  nat_gateway4_enabled = local.nat_gateway_enabled && !local.centralized_egress_enabled
 
   # Convert subnet names to indices if names were specified
   # Creates a map of subnet name -> index for easy lookup
@@ -224,7 +1140,7 @@ locals {
 
   # Calculate which public subnet indices to use for NAT placement
   # For each AZ (up to max_nats), and for each requested subnet index within that AZ,
-  # calculate the global subnet index in the flattened aws_subnet.public list
+  # calculate the global subnet index in the list of public subnets (`public_subnet_keys`)
   nat_gateway_public_subnet_indices = local.nat_gateway_useful ? flatten([
     for az_idx in range(min(local.vpc_az_count, var.max_nats)) : [
       for subnet_idx in local.nat_gateway_resolved_indices :
@@ -239,6 +1155,13 @@ locals {
   # How many NATs are created per AZ
   nats_per_az = local.nat_count > 0 ? length(local.nat_gateway_resolved_indices) : 0
 
+  # NAT devices (and their EIPs) are keyed by the key of the public subnet they are placed in
+  nat_keys             = [for i in local.nat_gateway_public_subnet_indices : try(local.public_subnet_keys[i], tostring(i))]
+  nat_key_to_index_map = { for i, k in local.nat_keys : k => i }
+  nat_gateway_list     = [for k in local.nat_keys : aws_nat_gateway.default[k] if local.nat_gateway_enabled]
+  nat_instance_list    = [for k in local.nat_keys : aws_instance.nat_instance[k] if local.nat_instance_standalone_enabled]
+  nat_eip_list         = [for k in local.nat_keys : aws_eip.default[k] if local.need_nat_eips]
+
   # For each private route table, calculate which NAT device it should route to
   # This ensures each private subnet routes to a NAT in its own AZ when possible
   # Used by both NAT Gateways and NAT Instances
@@ -259,7 +1182,7 @@ locals {
   # Example 3: 2 AZs, 1 private subnet per AZ, max_nats=1 (only 1 NAT total in AZ0)
   #   Route table 0 (AZ0) → NAT 0
   #   Route table 1 (AZ1) → NAT 0 (wraps to AZ0's NAT because AZ1 has no NAT)
-  private_route_table_to_nat_map = local.nat_enabled && local.private4_enabled ? [
+  private_route_table_to_nat_map = local.nat_enabled && local.private_enabled ? [
     for i in range(local.private_route_table_count) :
     # Calculate AZ index for this route table
     (floor(i / local.private_subnets_per_az_count) * local.nats_per_az +
@@ -299,26 +1222,179 @@ locals {
   nat_enabled          = local.nat_gateway_enabled || local.nat_instance_enabled
   need_nat_eips        = local.nat_enabled && length(var.nat_elastic_ips) == 0
   need_nat_eip_data    = local.nat_enabled && length(var.nat_elastic_ips) > 0
-  nat_eip_allocations  = local.nat_enabled ? (local.need_nat_eips ? aws_eip.default[*].id : data.aws_eip.nat[*].id) : []
+  nat_eip_allocations  = local.nat_enabled ? (local.need_nat_eips ? local.nat_eip_list[*].id : data.aws_eip.nat[*].id) : []
+
+  # NAT Gateways can have secondary Elastic IPs, for more ports for connections. Created ones are keyed "<NAT key>/<n>", with n from 1.
+  # Supplied ones follow the primary Elastic IPs in `nat_elastic_ips`, grouped by NAT Gateway.
+  nat_secondary_eip_count = local.nat_gateway_enabled ? var.nat_gateway_secondary_eip_count : 0
+  nat_secondary_eip_keys = {
+    for k in local.nat_keys : k => [for n in range(1, local.nat_secondary_eip_count + 1) : format("%s/%d", k, n)]
+  }
+  # The Elastic IPs to create, with the index of their NAT device and their number among its Elastic IPs (0 for the primary)
+  nat_eips = merge(
+    { for i, k in local.nat_keys : k => { nat_index = i, number = 0 } },
+    { for e in flatten([
+      for i, k in local.nat_keys : [for n, ek in local.nat_secondary_eip_keys[k] : { key = ek, nat_index = i, number = n + 1 }]
+    ]) : e.key => { nat_index = e.nat_index, number = e.number } },
+  )
+  nat_supplied_eip_count_valid = !local.need_nat_eip_data || length(var.nat_elastic_ips) >= local.nat_count * (1 + local.nat_secondary_eip_count)
+  # Without secondary Elastic IPs, all of the supplied ones are reported as in use, as they always have been
+  nat_supplied_primary_eips = local.nat_secondary_eip_count > 0 ? slice(var.nat_elastic_ips, 0, min(local.nat_count, length(var.nat_elastic_ips))) : var.nat_elastic_ips
+  nat_secondary_eip_allocations = {
+    for i, k in local.nat_keys : k => local.need_nat_eips ? [for ek in local.nat_secondary_eip_keys[k] : aws_eip.default[ek].id] : try(slice(
+      data.aws_eip.nat[*].id, local.nat_count + i * local.nat_secondary_eip_count, local.nat_count + (i + 1) * local.nat_secondary_eip_count
+    ), [])
+  }
+  nat_secondary_eip_public_ips = {
+    for i, k in local.nat_keys : k => local.need_nat_eips ? [for ek in local.nat_secondary_eip_keys[k] : aws_eip.default[ek].public_ip] : try(slice(
+      var.nat_elastic_ips, local.nat_count + i * local.nat_secondary_eip_count, local.nat_count + (i + 1) * local.nat_secondary_eip_count
+    ), [])
+  }
+  # The Elastic IPs of each NAT Gateway, primary first, keyed by the NAT key so that the keys are known at plan time
+  nat_gateway_eip_allocation_ids_map = {
+    for i, k in local.nat_keys : k => concat([local.nat_eip_allocations[i]], local.nat_secondary_eip_allocations[k]) if local.nat_gateway_enabled
+  }
+  nat_gateway_ips_map = {
+    for i, k in local.nat_keys : k => concat(
+      [local.need_nat_eip_data ? var.nat_elastic_ips[i] : local.nat_eip_list[i].public_ip], local.nat_secondary_eip_public_ips[k]
+    ) if local.nat_gateway_enabled
+  }
+
 
   need_nat_ami_id     = local.nat_instance_enabled && length(var.nat_instance_ami_id) == 0
   nat_instance_ami_id = local.need_nat_ami_id ? data.aws_ami.nat_instance[0].id : try(var.nat_instance_ami_id[0], "")
 
+  # How to find the latest AMI of each family
+  # aws ec2 describe-images --owners <owner> --filters Name=name,Values=<name>
+  nat_instance_ami_filters = {
+    "al2023"           = { owner = "amazon", name = "al2023-ami-2023.*" }
+    "fck-nat"          = { owner = "568608671756", name = "fck-nat-al2023-*" }
+    "amzn-ami-vpc-nat" = { owner = "amazon", name = "amzn-ami-vpc-nat*" }
+  }
+  nat_instance_ami_filter = local.nat_instance_ami_filters[var.nat_instance_ami_family]
+  # Look up the AMI for the architecture of the instance type, preferring ARM for instance types that support it
+  nat_instance_architecture = local.need_nat_ami_id ? (
+    contains(data.aws_ec2_instance_type.nat_instance[0].supported_architectures, "arm64") ? "arm64" : "x86_64"
+  ) : null
+
+  nat_instance_spot_enabled = local.nat_instance_enabled && var.nat_instance_spot.enabled
+  # Standalone NAT instances stop when interrupted, unless told otherwise
+  nat_instance_spot_interruption_behavior = coalesce(var.nat_instance_spot.interruption_behavior, "stop")
+
+  # NAT instances run either as standalone instances, or each in an Auto Scaling group of its own
+  nat_instance_asg_enabled        = local.nat_instance_enabled && var.nat_instance_auto_scaling_group_enabled
+  nat_instance_standalone_enabled = local.nat_instance_enabled && !var.nat_instance_auto_scaling_group_enabled
+  # The names of the launch templates and Auto Scaling groups, and the Name tags of the instances they launch,
+  # which the instance role is limited to
+  nat_instance_asg_names = {
+    for k, i in local.nat_key_to_index_map : k => format(
+      "%s%s%s", module.nat_instance_label.id, local.delimiter, local.public_subnet_az_abbreviations[local.nat_gateway_public_subnet_indices[i]]
+    ) if local.nat_instance_asg_enabled
+  }
+
+  # NAT instances perform NAT64 for the NAT egress subnets with DNS64 enabled
+  nat_instance_nat64_enabled         = local.nat_instance_enabled && var.nat_instance_nat64_enabled
+  private_nat_instance_nat64_enabled = local.nat_instance_nat64_enabled && local.private_dns64_enabled
+  tier_nat_instance_nat64_subnets    = { for k, v in local.additional_tier_subnets : k => v if local.nat_instance_nat64_enabled && v.egress == "nat" && v.dns64_enabled }
+
+  # The NAT instances need an instance role for their Auto Scaling groups to take over, to publish metrics, or when asked for one,
+  # unless an existing instance profile is supplied
+  nat_instance_metrics_enabled   = local.nat_instance_enabled && var.nat_instance_metrics_enabled
+  nat_instance_metrics_namespace = "NATInstance"
+  nat_instance_iam_role_enabled = local.nat_instance_enabled && var.nat_instance_iam_instance_profile.name == null && (
+    local.nat_instance_asg_enabled || local.nat_instance_metrics_enabled || var.nat_instance_iam_instance_profile.enabled
+  )
+  # The permissions the module grants the NAT instances in a policy of their role
+  nat_instance_iam_policy_enabled = local.nat_instance_iam_role_enabled && (local.nat_instance_asg_enabled || local.nat_instance_metrics_enabled)
+  nat_instance_iam_managed_policies = local.nat_instance_iam_role_enabled && var.nat_instance_iam_instance_profile.enabled ? concat(
+    var.nat_instance_iam_instance_profile.ssm_enabled ? ["AmazonSSMManagedInstanceCore"] : [],
+    var.nat_instance_iam_instance_profile.cloudwatch_agent_enabled ? ["CloudWatchAgentServerPolicy"] : [],
+  ) : []
+  nat_instance_iam_instance_profile_name = local.nat_instance_iam_role_enabled ? aws_iam_instance_profile.nat_instance[0].name : var.nat_instance_iam_instance_profile.name
+
+  # The NAT instances accept traffic from the subnets that route to them, and from the CIDRs and prefix lists they are told to
+  nat_instance_egress_tiers = [for k, v in local.subnet_tiers : k if v.enabled && v.egress == "nat"]
+  nat_instance_ingress_ipv4_cidrs = distinct(concat(
+    flatten([for k in local.nat_instance_egress_tiers : local.tier_subnet_cidrs[k]]),
+    var.nat_instance_security_group.allowed_ipv4_cidrs,
+  ))
+  nat_instance_ingress_ipv6_cidrs = distinct(concat(
+    local.nat_instance_nat64_enabled ? flatten([for k in local.nat_instance_egress_tiers : local.tier_subnet_ipv6_cidrs[k]]) : [],
+    var.nat_instance_security_group.allowed_ipv6_cidrs,
+  ))
+  # Subnet CIDRs allocated from IPAM are not known until applied, so count them without `distinct`
+  nat_instance_ingress_ipv4_enabled = local.nat_instance_enabled && length(flatten(concat(
+    [for k in local.nat_instance_egress_tiers : local.tier_subnet_cidrs[k]], [var.nat_instance_security_group.allowed_ipv4_cidrs]
+  ))) > 0
+  nat_instance_ingress_ipv6_enabled = local.nat_instance_enabled && length(flatten(concat(
+    local.nat_instance_nat64_enabled ? [for k in local.nat_instance_egress_tiers : local.tier_subnet_ipv6_cidrs[k]] : [], [var.nat_instance_security_group.allowed_ipv6_cidrs]
+  ))) > 0
+  nat_instance_egress_rules = var.nat_instance_security_group.egress_rules
+  nat_instance_security_group_ids = local.nat_instance_enabled ? concat(
+    aws_security_group.nat_instance[*].id, var.nat_instance_security_group.additional_security_group_ids
+  ) : []
+
+  # The route tables each NAT instance serves, which it points at itself when launched by its Auto Scaling group
+  nat_instance_route_tables = { for i, k in local.nat_keys : k => concat(
+    [for rt, idx in local.private_route_table_key_to_index_map : aws_route_table.private[rt] if local.private4_enabled && local.private_route_table_to_nat_map[idx] == i],
+    [for sk, v in local.additional_tier_subnets : aws_route_table.tier[sk] if v.egress == "nat" && v.ipv4_enabled && v.nat_key == k],
+  ) if local.nat_instance_asg_enabled }
+  nat_instance_nat64_route_tables = { for i, k in local.nat_keys : k => concat(
+    [for rt, idx in local.private_route_table_key_to_index_map : aws_route_table.private[rt] if local.private_nat_instance_nat64_enabled && local.private_route_table_to_nat_map[idx] == i],
+    [for sk, v in local.tier_nat_instance_nat64_subnets : aws_route_table.tier[sk] if v.nat_key == k],
+  ) if local.nat_instance_asg_enabled }
+
+  # Only Amazon Linux 2023 needs to be told to perform NAT; the other AMIs are built for it
+  nat_instance_user_data = {
+    for i, k in local.nat_keys : k => templatefile("${path.module}/templates/nat-instance-user-data.sh.tftpl", {
+      configure_nat         = var.nat_instance_ami_family == "al2023"
+      nat64                 = local.nat_instance_nat64_enabled
+      nat64_cidr            = local.nat64_cidr
+      tayga_url             = try(var.nat_instance_nat64_tayga_source.url, "")
+      tayga_sha256          = try(var.nat_instance_nat64_tayga_source.sha256, "")
+      self_healing          = local.nat_instance_asg_enabled
+      allocation_id         = local.nat_eip_allocations[i]
+      route_table_ids       = local.nat_instance_asg_enabled ? local.nat_instance_route_tables[k][*].id : []
+      nat64_route_table_ids = local.nat_instance_asg_enabled ? local.nat_instance_nat64_route_tables[k][*].id : []
+      metrics               = local.nat_instance_metrics_enabled
+      metrics_namespace     = local.nat_instance_metrics_namespace
+    }) if local.nat_instance_enabled && (var.nat_instance_ami_family == "al2023" || local.nat_instance_asg_enabled || local.nat_instance_metrics_enabled)
+  }
+
   # Locals for outputs
+  # Resources created with `for_each` are listed in key order, so put them back in the order of their indices
+  private_subnet_list = [for k in local.private_subnet_keys : aws_subnet.private[k]]
+  public_subnet_list  = [for k in local.public_subnet_keys : aws_subnet.public[k]]
+  intra_subnet_list   = [for k in local.intra_subnet_keys : aws_subnet.intra[k]]
+
+  private_route_table_association_list = [for k in local.private_subnet_keys : aws_route_table_association.private[k] if local.private_route_table_enabled]
+  public_route_table_association_list  = [for k in local.public_subnet_keys : aws_route_table_association.public[k] if local.public_route_table_enabled]
+  intra_route_table_association_list   = [for k in local.intra_subnet_keys : aws_route_table_association.intra[k]]
+
+  created_public_route_table_ids = [for k in local.created_public_route_table_keys : aws_route_table.public[k].id]
+
   az_private_subnets_map = { for z in local.vpc_availability_zones : z => (
-    [for s in aws_subnet.private : s.id if s.availability_zone == z])
+    [for s in local.private_subnet_list : s.id if s.availability_zone == z])
   }
 
   az_public_subnets_map = { for z in local.vpc_availability_zones : z => (
-    [for s in aws_subnet.public : s.id if s.availability_zone == z])
+    [for s in local.public_subnet_list : s.id if s.availability_zone == z])
+  }
+
+  az_intra_subnets_map = { for z in local.vpc_availability_zones : z => (
+    [for s in local.intra_subnet_list : s.id if s.availability_zone == z])
   }
 
   az_private_route_table_ids_map = { for k, v in local.az_private_subnets_map : k => (
-    [for t in aws_route_table_association.private : t.route_table_id if contains(v, t.subnet_id)])
+    [for t in local.private_route_table_association_list : t.route_table_id if contains(v, t.subnet_id)])
   }
 
   az_public_route_table_ids_map = { for k, v in local.az_public_subnets_map : k => (
-    [for t in aws_route_table_association.public : t.route_table_id if contains(v, t.subnet_id)])
+    [for t in local.public_route_table_association_list : t.route_table_id if contains(v, t.subnet_id)])
+  }
+
+  az_intra_route_table_ids_map = { for k, v in local.az_intra_subnets_map : k => (
+    [for t in local.intra_route_table_association_list : t.route_table_id if contains(v, t.subnet_id)])
   }
 
   named_private_subnets_map = { for i, s in local.private_subnets_per_az_names : s => (
@@ -329,6 +1405,10 @@ locals {
     compact([for k, v in local.az_public_subnets_map : try(v[i], "")]))
   }
 
+  named_intra_subnets_map = { for i, s in local.intra_subnets_per_az_names : s => (
+    compact([for k, v in local.az_intra_subnets_map : try(v[i], "")]))
+  }
+
   named_private_route_table_ids_map = { for i, s in local.private_subnets_per_az_names : s => (
     compact([for k, v in local.az_private_route_table_ids_map : try(v[i], "")]))
   }
@@ -337,15 +1417,118 @@ locals {
     compact([for k, v in local.az_public_route_table_ids_map : try(v[i], "")]))
   }
 
+  named_intra_route_table_ids_map = { for i, s in local.intra_subnets_per_az_names : s => (
+    compact([for k, v in local.az_intra_route_table_ids_map : try(v[i], "")]))
+  }
+
   # Create a map from public subnet ID to NAT Gateway ID (for public subnets that have NAT Gateways)
-  public_subnet_to_nat_gateway_map = { for nat in aws_nat_gateway.default : nat.subnet_id => nat.id }
+  public_subnet_to_nat_gateway_map = { for nat in local.nat_gateway_list : nat.subnet_id => nat.id }
 
   # Create a map from private subnet ID to NAT Gateway ID (the NAT that the private subnet routes to)
-  private_subnet_to_nat_gateway_map = local.nat_gateway_enabled && local.private4_enabled ? {
-    for idx, subnet in aws_subnet.private :
-    subnet.id => aws_nat_gateway.default[local.private_route_table_to_nat_map[idx]].id
+  private_subnet_to_nat_gateway_map = local.nat_gateway4_enabled && local.private4_enabled ? {
+    for idx, subnet in local.private_subnet_list :
+    subnet.id => local.nat_gateway_list[local.private_route_table_to_nat_map[idx]].id
   } : {}
 
+  # Outputs covering every tier, built-in and additional
+  tier_subnet_ids = merge(
+    { for k in local.additional_subnet_tier_keys : k => [for s in local.additional_tier_subnet_list : aws_subnet.tier[s.key].id if s.tier == k] },
+    { private = local.private_subnet_list[*].id, public = local.public_subnet_list[*].id, intra = local.intra_subnet_list[*].id }
+  )
+
+  tier_subnet_cidrs = merge(
+    { for k in local.additional_subnet_tier_keys : k => [for s in local.additional_tier_subnet_list : aws_subnet.tier[s.key].cidr_block if s.tier == k && s.ipv4_enabled] },
+    {
+      private = local.private4_enabled ? local.private_subnet_list[*].cidr_block : []
+      public  = local.public4_enabled ? local.public_subnet_list[*].cidr_block : []
+      intra   = local.intra4_enabled ? local.intra_subnet_list[*].cidr_block : []
+    }
+  )
+
+  tier_subnet_ipv6_cidrs = merge(
+    { for k in local.additional_subnet_tier_keys : k => [for s in local.additional_tier_subnet_list : aws_subnet.tier[s.key].ipv6_cidr_block if s.tier == k && s.ipv6_enabled] },
+    {
+      private = local.private6_enabled ? local.private_subnet_list[*].ipv6_cidr_block : []
+      public  = local.public6_enabled ? local.public_subnet_list[*].ipv6_cidr_block : []
+      intra   = local.intra6_enabled ? local.intra_subnet_list[*].ipv6_cidr_block : []
+    }
+  )
+
+  tier_route_table_ids = merge(
+    { for k in local.additional_subnet_tier_keys : k => [for s in local.additional_tier_subnet_list : aws_route_table.tier[s.key].id if s.tier == k] },
+    { private = local.private_route_table_ids, public = local.created_public_route_table_ids, intra = local.intra_route_table_ids }
+  )
+
+  tier_network_acl_ids = merge(
+    { for k in local.additional_subnet_tier_keys : k => try(aws_network_acl.tier[k].id, null) },
+    {
+      private = local.private_network_acl_enabled ? aws_network_acl.private[0].id : null
+      public  = local.public_network_acl_enabled ? aws_network_acl.public[0].id : null
+      intra   = local.intra_network_acl_enabled ? aws_network_acl.intra[0].id : null
+    }
+  )
+
+  az_tier_subnets_map = merge(
+    { for k in local.additional_subnet_tier_keys : k => { for z in local.vpc_availability_zones : z => (
+      [for s in local.additional_tier_subnet_list : aws_subnet.tier[s.key].id if s.tier == k && s.availability_zone == z])
+    } },
+    { private = local.az_private_subnets_map, public = local.az_public_subnets_map, intra = local.az_intra_subnets_map }
+  )
+
+  named_tier_subnets_map = merge(
+    { for k in local.additional_subnet_tier_keys : k => { for n in local.subnet_tiers[k].subnets_per_az_names : n => (
+      [for s in local.additional_tier_subnet_list : aws_subnet.tier[s.key].id if s.tier == k && s.name == n])
+    } },
+    { private = local.named_private_subnets_map, public = local.named_public_subnets_map, intra = local.named_intra_subnets_map }
+  )
+
+  named_tier_route_table_ids_map = merge(
+    { for k in local.additional_subnet_tier_keys : k => { for n in local.subnet_tiers[k].subnets_per_az_names : n => (
+      [for s in local.additional_tier_subnet_list : aws_route_table.tier[s.key].id if s.tier == k && s.name == n])
+    } },
+    { private = local.named_private_route_table_ids_map, public = local.named_public_route_table_ids_map, intra = local.named_intra_route_table_ids_map }
+  )
+
+  # The network ACL of the subnets with each name: their own, if any, otherwise that of their tier
+  named_tier_network_acl_ids_map = { for k in local.subnet_tier_keys : k => {
+    for n in distinct(local.subnet_tiers[k].subnets_per_az_names) : n => try(
+      aws_network_acl.named[format("%s/%s", k, n)].id,
+      local.named_supplied_network_acls[format("%s/%s", k, n)].network_acl_id,
+      # With supplied network ACLs, the one the subnets with this name have, or null if they have different ones
+      contains(keys(local.supplied_tier_network_acl_ids), k) ? one(distinct([
+        for a in values(local.supplied_network_acl_associations) : a.network_acl_id if a.tier == k && try(split("/", a.subnet_key)[1], "") == n
+      ])) : local.tier_network_acl_ids[k],
+      null
+    )
+  } if local.e && local.subnet_tiers[k].enabled }
+
+  # Earlier versions of this module created these resources with `count`. A `moved` block cannot be generated
+  # from variables, so the moves from the old addresses to the new ones are computed here for the caller to apply.
+  count_to_for_each_state_moves = merge([
+    for r in [
+      { address = "aws_subnet.private", keys = local.private_subnet_keys },
+      { address = "aws_subnet.public", keys = local.public_subnet_keys },
+      { address = "aws_subnet.intra", keys = local.intra_subnet_keys },
+      { address = "aws_route_table.private", keys = local.private_route_table_keys },
+      { address = "aws_route_table.public", keys = local.created_public_route_table_keys },
+      { address = "aws_route_table.intra", keys = local.intra_subnet_keys },
+      { address = "aws_route_table_association.private", keys = local.private_route_table_keys },
+      { address = "aws_route_table_association.public", keys = local.public_route_table_enabled ? local.public_subnet_keys : [] },
+      { address = "aws_route_table_association.intra", keys = local.intra_subnet_keys },
+      { address = "aws_route.public", keys = local.public4_enabled && local.igw_configured ? local.public_route_table_keys : [] },
+      { address = "aws_route.public6", keys = local.public6_enabled && local.igw_configured ? local.public_route_table_keys : [] },
+      { address = "aws_route.private6", keys = local.private_egress_only6_enabled ? local.private_route_table_keys : [] },
+      { address = "aws_route.nat4", keys = local.nat_gateway4_enabled && local.private4_enabled ? local.private_route_table_keys : [] },
+      { address = "aws_route.private_nat64", keys = local.nat_gateway_enabled && local.private_nat64_nat_gateway_enabled && local.private_dns64_enabled ? local.private_route_table_keys : [] },
+      { address = "aws_route.public_nat64", keys = local.nat_gateway_enabled && local.public_dns64_enabled ? local.public_route_table_keys : [] },
+      { address = "aws_route.nat_instance", keys = local.nat_instance_standalone_enabled && local.private4_enabled ? local.private_route_table_keys : [] },
+      { address = "aws_eip.default", keys = local.need_nat_eips ? local.nat_keys : [] },
+      { address = "aws_nat_gateway.default", keys = local.nat_gateway_enabled ? local.nat_keys : [] },
+      { address = "aws_instance.nat_instance", keys = local.nat_instance_standalone_enabled ? local.nat_keys : [] },
+      { address = "aws_eip_association.nat_instance", keys = local.nat_instance_standalone_enabled ? local.nat_keys : [] },
+    ] : { for i, k in r.keys : format("%s[%d]", r.address, i) => format("%s[%q]", r.address, k) }
+  ]...)
+
   named_private_subnets_stats_map = { for i, s in local.private_subnets_per_az_names : s => (
     [
       for k, v in local.az_private_route_table_ids_map : {
@@ -357,6 +1540,15 @@ locals {
     ])
   }
 
+  # The interface VPC endpoints by service, then by AZ, with the zonal DNS names of the endpoint in that AZ
+  az_interface_vpc_endpoints_map = { for k, e in aws_vpc_endpoint.interface : k => {
+    for i, az in local.vpc_availability_zones : az => {
+      vpc_endpoint_id = e.id
+      subnet_id       = local.interface_vpc_endpoint_subnet_ids[i]
+      dns_names       = [for d in e.dns_entry : d.dns_name if length(regexall(format("-%s\\.", az), d.dns_name)) > 0]
+    }
+  } if local.interface_vpc_endpoint_subnets_valid }
+
   named_public_subnets_stats_map = { for i, s in local.public_subnets_per_az_names : s => (
     [
       for k, v in local.az_public_route_table_ids_map : {
@@ -367,6 +1559,16 @@ locals {
       }
     ])
   }
+
+  named_intra_subnets_stats_map = { for i, s in local.intra_subnets_per_az_names : s => (
+    [
+      for k, v in local.az_intra_route_table_ids_map : {
+        az             = k
+        route_table_id = try(v[i], "")
+        subnet_id      = try(local.az_intra_subnets_map[k][i], "")
+      }
+    ])
+  }
 }
 
 data "aws_availability_zones" "default" {
@@ -385,6 +1587,23 @@ data "aws_vpc" "default" {
   id = local.vpc_id
 }
 
+# Checks the computed CIDRs of every tier once, rather than in each of the subnet resources
+resource "terraform_data" "subnet_cidrs" {
+  count = local.enabled ? 1 : 0
+
+  lifecycle {
+    precondition {
+      condition     = length(local.cidr_grid_invalid_reasons) == 0
+      error_message = "The `cidr_grid` does not fit the subnets: ${join("; ", local.cidr_grid_invalid_reasons)}."
+    }
+
+    precondition {
+      condition     = length(local.ipv4_cidr_slot_invalid_reasons) == 0
+      error_message = "The subnet sizes do not fit in their IPv4 CIDR blocks: ${join("; ", local.ipv4_cidr_slot_invalid_reasons)}."
+    }
+  }
+}
+
 data "aws_eip" "nat" {
   count = local.need_nat_eip_data ? length(var.nat_elastic_ips) : 0
 
@@ -392,7 +1611,7 @@ data "aws_eip" "nat" {
 }
 
 resource "aws_eip" "default" {
-  count = local.need_nat_eips ? local.nat_count : 0
+  for_each = local.need_nat_eips ? local.nat_eips : {}
 
   # `vpc` is deprecated in favor of `domain = "vpc"` in version 5 of the AWS provider.
   # However, the `domain` attribute is not available in version 4.
@@ -405,7 +1624,10 @@ resource "aws_eip" "default" {
   tags = merge(
     module.nat_label.tags,
     {
-      "Name" = format("%s%s%s", module.nat_label.id, local.delimiter, local.public_subnet_az_abbreviations[local.nat_gateway_public_subnet_indices[count.index]])
+      "Name" = join(local.delimiter, concat(
+        [module.nat_label.id, local.public_subnet_az_abbreviations[local.nat_gateway_public_subnet_indices[each.value.nat_index]]],
+        each.value.number > 0 ? [tostring(each.value.number)] : []
+      ))
     }
   )
 
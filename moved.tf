@@ -14,3 +14,198 @@ moved {
   from = aws_route_table_association.public_default
   to   = aws_route_table_association.public
 }
+
+# The subnets, route tables, route table associations, routes, NAT Gateways, NAT instances and their EIPs
+# used to be created with `count` and are now created with `for_each`, keyed by AZ and subnet name
+# (e.g. `aws_subnet.private[0]` is now `aws_subnet.private["use2a/app"]`). The keys depend on the region
+# and the subnet names, which `moved` blocks cannot refer to, so those moves cannot be declared here.
+# Instead, the `count_to_for_each_state_moves` output lists them for the caller to apply with `terraform state mv`.
+# See docs/migration-v2-v3.md.
+#
+# To keep an upgrade that skips that step from replacing every resource (and changing the NAT IPs), the first
+# instance of each resource that used `count` is moved to a `count_state_not_migrated` resource below. Those have
+# no instances, so Terraform plans to destroy whatever is moved there, and `prevent_destroy` makes the plan fail.
+# State created with `for_each` has no such instance, so this only affects state that has not been migrated.
+# The arguments of these resources are placeholders, since they never have any instances.
+
+resource "aws_subnet" "count_state_not_migrated" {
+  count = 0
+
+  vpc_id = local.vpc_id
+
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+
+resource "aws_route_table" "count_state_not_migrated" {
+  count = 0
+
+  vpc_id = local.vpc_id
+
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+
+resource "aws_route_table_association" "count_state_not_migrated" {
+  count = 0
+
+  route_table_id = ""
+  subnet_id      = ""
+
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+
+resource "aws_route" "count_state_not_migrated" {
+  count = 0
+
+  route_table_id         = ""
+  destination_cidr_block = "0.0.0.0/0"
+  gateway_id             = ""
+
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+
+resource "aws_eip" "count_state_not_migrated" {
+  count = 0
+
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+
+resource "aws_nat_gateway" "count_state_not_migrated" {
+  count = 0
+
+  subnet_id = ""
+
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+
+resource "aws_instance" "count_state_not_migrated" {
+  count = 0
+
+  ami           = ""
+  instance_type = ""
+
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+
+resource "aws_eip_association" "count_state_not_migrated" {
+  count = 0
+
+  instance_id = ""
+
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+
+moved {
+  from = aws_subnet.private[0]
+  to   = aws_subnet.count_state_not_migrated[0]
+}
+
+moved {
+  from = aws_subnet.public[0]
+  to   = aws_subnet.count_state_not_migrated[1]
+}
+
+moved {
+  from = aws_subnet.intra[0]
+  to   = aws_subnet.count_state_not_migrated[2]
+}
+
+moved {
+  from = aws_route_table.private[0]
+  to   = aws_route_table.count_state_not_migrated[0]
+}
+
+moved {
+  from = aws_route_table.public[0]
+  to   = aws_route_table.count_state_not_migrated[1]
+}
+
+moved {
+  from = aws_route_table.intra[0]
+  to   = aws_route_table.count_state_not_migrated[2]
+}
+
+moved {
+  from = aws_route_table_association.private[0]
+  to   = aws_route_table_association.count_state_not_migrated[0]
+}
+
+moved {
+  from = aws_route_table_association.public[0]
+  to   = aws_route_table_association.count_state_not_migrated[1]
+}
+
+moved {
+  from = aws_route_table_association.intra[0]
+  to   = aws_route_table_association.count_state_not_migrated[2]
+}
+
+moved {
+  from = aws_route.public[0]
+  to   = aws_route.count_state_not_migrated[0]
+}
+
+moved {
+  from = aws_route.public6[0]
+  to   = aws_route.count_state_not_migrated[1]
+}
+
+moved {
+  from = aws_route.private6[0]
+  to   = aws_route.count_state_not_migrated[2]
+}
+
+moved {
+  from = aws_route.nat4[0]
+  to   = aws_route.count_state_not_migrated[3]
+}
+
+moved {
+  from = aws_route.private_nat64[0]
+  to   = aws_route.count_state_not_migrated[4]
+}
+
+moved {
+  from = aws_route.public_nat64[0]
+  to   = aws_route.count_state_not_migrated[5]
+}
+
+moved {
+  from = aws_route.nat_instance[0]
+  to   = aws_route.count_state_not_migrated[6]
+}
+
+moved {
+  from = aws_eip.default[0]
+  to   = aws_eip.count_state_not_migrated[0]
+}
+
+moved {
+  from = aws_nat_gateway.default[0]
+  to   = aws_nat_gateway.count_state_not_migrated[0]
+}
+
+moved {
+  from = aws_instance.nat_instance[0]
+  to   = aws_instance.count_state_not_migrated[0]
+}
+
+moved {
+  from = aws_eip_association.nat_instance[0]
+  to   = aws_eip_association.count_state_not_migrated[0]
+}
@@ -8,15 +8,16 @@ module "nat_label" {
 }
 
 resource "aws_nat_gateway" "default" {
-  count = local.nat_gateway_enabled ? local.nat_count : 0
+  for_each = local.nat_gateway_enabled ? local.nat_key_to_index_map : {}
 
-  allocation_id = local.nat_eip_allocations[count.index]
-  subnet_id     = aws_subnet.public[local.nat_gateway_public_subnet_indices[count.index]].id
+  allocation_id            = local.nat_eip_allocations[each.value]
+  secondary_allocation_ids = local.nat_secondary_eip_count > 0 ? local.nat_secondary_eip_allocations[each.key] : null
+  subnet_id                = aws_subnet.public[each.key].id
 
   tags = merge(
     module.nat_label.tags,
     {
-      "Name" = format("%s%s%s", module.nat_label.id, local.delimiter, local.public_subnet_az_abbreviations[local.nat_gateway_public_subnet_indices[count.index]])
+      "Name" = format("%s%s%s", module.nat_label.id, local.delimiter, local.public_subnet_az_abbreviations[local.nat_gateway_public_subnet_indices[each.value]])
     }
   )
 
@@ -27,6 +28,10 @@ resource "aws_nat_gateway" "default" {
       condition     = local.nat_gateway_names_valid
       error_message = "Invalid subnet names specified in `nat_gateway_public_subnet_names`: ${join(", ", local.nat_gateway_invalid_names)}. Valid names from `public_subnets_per_az_names` are: ${join(", ", local.public_subnets_per_az_names)}."
     }
+    precondition {
+      condition     = local.nat_supplied_eip_count_valid
+      error_message = "The ${local.nat_count} NAT Gateways with ${local.nat_secondary_eip_count} secondary Elastic IPs each need ${local.nat_count * (1 + local.nat_secondary_eip_count)} `nat_elastic_ips`, but ${length(var.nat_elastic_ips)} are given."
+    }
   }
 }
 
@@ -34,10 +39,10 @@ resource "aws_nat_gateway" "default" {
 # default route from private subnet to NAT Gateway in each subnet
 # Each private subnet routes to a NAT in its own AZ
 resource "aws_route" "nat4" {
-  count = local.nat_gateway_enabled && local.private4_enabled ? local.private_route_table_count : 0
+  for_each = local.nat_gateway4_enabled && local.private4_enabled ? local.private_route_table_key_to_index_map : {}
 
-  route_table_id         = local.private_route_table_ids[count.index]
-  nat_gateway_id         = aws_nat_gateway.default[local.private_route_table_to_nat_map[count.index]].id
+  route_table_id         = aws_route_table.private[each.key].id
+  nat_gateway_id         = aws_nat_gateway.default[local.nat_keys[local.private_route_table_to_nat_map[each.value]]].id
   destination_cidr_block = "0.0.0.0/0"
   depends_on             = [aws_route_table.private]
 
@@ -51,10 +56,10 @@ resource "aws_route" "nat4" {
 # NAT64 route from private subnet to NAT Gateway in each subnet
 # Each private subnet routes to a NAT in its own AZ
 resource "aws_route" "private_nat64" {
-  count = local.nat_gateway_enabled && local.private_dns64_enabled ? local.private_route_table_count : 0
+  for_each = local.nat_gateway_enabled && local.private_nat64_nat_gateway_enabled && local.private_dns64_enabled ? local.private_route_table_key_to_index_map : {}
 
-  route_table_id              = local.private_route_table_ids[count.index]
-  nat_gateway_id              = aws_nat_gateway.default[local.private_route_table_to_nat_map[count.index]].id
+  route_table_id              = aws_route_table.private[each.key].id
+  nat_gateway_id              = aws_nat_gateway.default[local.nat_keys[local.private_route_table_to_nat_map[each.value]]].id
   destination_ipv6_cidr_block = local.nat64_cidr
   depends_on                  = [aws_route_table.private]
 
@@ -68,10 +73,10 @@ resource "aws_route" "private_nat64" {
 # NAT64 route from public subnet to NAT Gateway in each subnet
 # Each public subnet routes to a NAT in its own AZ
 resource "aws_route" "public_nat64" {
-  count = local.nat_gateway_enabled && local.public_dns64_enabled ? local.public_route_table_count : 0
+  for_each = local.nat_gateway_enabled && local.public_dns64_enabled ? local.public_route_table_key_to_index_map : {}
 
-  route_table_id              = local.public_route_table_ids[count.index]
-  nat_gateway_id              = aws_nat_gateway.default[local.public_route_table_to_nat_map[count.index]].id
+  route_table_id              = local.public_route_table_ids[each.value]
+  nat_gateway_id              = aws_nat_gateway.default[local.nat_keys[local.public_route_table_to_nat_map[each.value]]].id
   destination_ipv6_cidr_block = local.nat64_cidr
   depends_on                  = [aws_route_table.public]
 
@@ -80,3 +85,54 @@ resource "aws_route" "public_nat64" {
     delete = local.route_delete_timeout
   }
 }
+
+module "private_nat_label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+
+  attributes = ["private"]
+
+  context = module.nat_label.context
+}
+
+# Private NAT Gateways, for subnets that reach other private networks through them
+resource "aws_nat_gateway" "private" {
+  for_each = { for i, k in local.private_nat_gateway_keys : k => local.private_nat_gateway_azs[i] }
+
+  connectivity_type                  = "private"
+  subnet_id                          = try(aws_subnet.private[each.key].id, null)
+  secondary_private_ip_address_count = var.private_nat_gateway.secondary_private_ip_address_count > 0 ? var.private_nat_gateway.secondary_private_ip_address_count : null
+
+  tags = merge(
+    module.private_nat_label.tags,
+    {
+      "Name" = format("%s%s%s", module.private_nat_label.id, local.delimiter, local.az_abbreviation_map[each.value])
+    }
+  )
+
+  lifecycle {
+    precondition {
+      condition     = local.private_nat_gateway_subnets_valid
+      error_message = "The private NAT Gateways go in the `${local.private_nat_gateway_subnet_name}` private subnets, but there are none. Set `private_nat_gateway.subnet_name` to one of `private_subnets_per_az_names`: ${join(", ", local.private_subnets_per_az_names)}."
+    }
+    precondition {
+      condition     = length(local.private_nat_gateway_invalid_tiers) == 0
+      error_message = "Invalid subnet tiers in `private_nat_gateway.subnet_tiers`: ${join(", ", local.private_nat_gateway_invalid_tiers)}. The `public` tier cannot use private NAT Gateways."
+    }
+  }
+}
+
+# Routes from the route tables of `private_nat_gateway.subnet_tiers` to the private NAT Gateway in their AZ
+resource "aws_route" "private_nat_gateway" {
+  for_each = local.private_nat_gateway_routes
+
+  route_table_id             = local.tier_route_table_id_map[each.value.tier][each.value.route_table_key]
+  nat_gateway_id             = aws_nat_gateway.private[each.value.nat_key].id
+  destination_cidr_block     = each.value.cidr_block
+  destination_prefix_list_id = each.value.prefix_list_id
+
+  timeouts {
+    create = local.route_create_timeout
+    delete = local.route_delete_timeout
+  }
+}
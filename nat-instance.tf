@@ -1,6 +1,7 @@
 
 # AWS NAT Instances are being phased out, and do not support IPv6 traffic,
-# such as NAT64, so this module does not support IPv6 traffic to NAT instances.
+# such as NAT64, so this module only supports IPv6 traffic to NAT instances
+# when they run their own NAT64 translator (see `nat_instance_nat64_enabled`).
 # NAT Gateways are recommended instead.
 
 module "nat_instance_label" {
@@ -24,33 +25,99 @@ resource "aws_security_group" "nat_instance" {
   description = "Security Group for NAT Instance"
   vpc_id      = local.vpc_id
   tags        = module.nat_instance_label.tags
+
+  lifecycle {
+    precondition {
+      condition     = !local.nat_instance_nat64_enabled || (local.public6_enabled && var.nat_instance_ami_family == "al2023")
+      error_message = "NAT64 on NAT instances (`nat_instance_nat64_enabled`) requires IPv6 in the public subnets and `nat_instance_ami_family = \"al2023\"`."
+    }
+    precondition {
+      condition     = !local.nat_instance_nat64_enabled || var.nat_instance_nat64_tayga_source != null
+      error_message = "NAT64 on NAT instances (`nat_instance_nat64_enabled`) needs the URL and SHA-256 checksum of a TAYGA release in `nat_instance_nat64_tayga_source`."
+    }
+    precondition {
+      condition     = !local.nat_instance_metrics_enabled || var.metadata_http_endpoint_enabled
+      error_message = "NAT instance metrics (`nat_instance_metrics_enabled`) need the instance metadata service. Set `metadata_http_endpoint_enabled` to `true`."
+    }
+    precondition {
+      condition     = !local.nat_instance_metrics_enabled || var.nat_instance_ami_family != "amzn-ami-vpc-nat"
+      error_message = "NAT instance metrics (`nat_instance_metrics_enabled`) are published by a systemd timer, which the Amazon Linux 1 NAT AMI does not have. Use `nat_instance_ami_family = \"al2023\"` or `\"fck-nat\"`."
+    }
+  }
 }
 
+# The first egress rule keeps the address of the former single "allow all" rule, so that the default does not change it
 resource "aws_security_group_rule" "nat_instance_egress" {
   count = local.nat_instance_enabled ? 1 : 0
 
-  description       = "Allow all egress traffic"
+  description       = local.nat_instance_egress_rules[0].description
+  from_port         = local.nat_instance_egress_rules[0].from_port
+  to_port           = local.nat_instance_egress_rules[0].to_port
+  protocol          = local.nat_instance_egress_rules[0].protocol
+  cidr_blocks       = local.nat_instance_egress_rules[0].cidr_blocks #tfsec:ignore:aws-ec2-no-public-egress-sgr
+  ipv6_cidr_blocks  = local.nat_instance_egress_rules[0].ipv6_cidr_blocks
+  prefix_list_ids   = local.nat_instance_egress_rules[0].prefix_list_ids
+  security_group_id = join("", aws_security_group.nat_instance[*].id)
+  type              = "egress"
+}
+
+resource "aws_security_group_rule" "nat_instance_additional_egress" {
+  for_each = local.nat_instance_enabled ? { for i, r in local.nat_instance_egress_rules : tostring(i) => r if i > 0 } : {}
+
+  description       = each.value.description
+  from_port         = each.value.from_port
+  to_port           = each.value.to_port
+  protocol          = each.value.protocol
+  cidr_blocks       = each.value.cidr_blocks
+  ipv6_cidr_blocks  = each.value.ipv6_cidr_blocks
+  prefix_list_ids   = each.value.prefix_list_ids
+  security_group_id = join("", aws_security_group.nat_instance[*].id)
+  type              = "egress"
+}
+
+resource "aws_security_group_rule" "nat_instance_ingress" {
+  count = local.nat_instance_ingress_ipv4_enabled ? 1 : 0
+
+  description       = "Allow ingress traffic from the subnets that use the NAT instances"
   from_port         = 0
   to_port           = 0
   protocol          = "-1"
-  cidr_blocks       = ["0.0.0.0/0"] #tfsec:ignore:aws-ec2-no-public-egress-sgr
+  cidr_blocks       = local.nat_instance_ingress_ipv4_cidrs
   security_group_id = join("", aws_security_group.nat_instance[*].id)
-  type              = "egress"
+  type              = "ingress"
 }
 
-resource "aws_security_group_rule" "nat_instance_ingress" {
-  count = local.nat_instance_enabled ? 1 : 0
+resource "aws_security_group_rule" "nat_instance_ingress6" {
+  count = local.nat_instance_ingress_ipv6_enabled ? 1 : 0
+
+  description       = "Allow ingress IPv6 traffic, such as NAT64, from the subnets that use the NAT instances"
+  from_port         = 0
+  to_port           = 0
+  protocol          = "-1"
+  ipv6_cidr_blocks  = local.nat_instance_ingress_ipv6_cidrs
+  security_group_id = join("", aws_security_group.nat_instance[*].id)
+  type              = "ingress"
+}
 
-  description       = "Allow ingress traffic from the VPC CIDR block"
+resource "aws_security_group_rule" "nat_instance_ingress_prefix_lists" {
+  count = local.nat_instance_enabled && length(var.nat_instance_security_group.allowed_prefix_list_ids) > 0 ? 1 : 0
+
+  description       = "Allow ingress traffic from the allowed prefix lists"
   from_port         = 0
   to_port           = 0
   protocol          = "-1"
-  cidr_blocks       = [local.base_ipv4_cidr_block]
+  prefix_list_ids   = var.nat_instance_security_group.allowed_prefix_list_ids
   security_group_id = join("", aws_security_group.nat_instance[*].id)
   type              = "ingress"
 }
 
-# aws --region us-west-2 ec2 describe-images --owners amazon --filters Name="name",Values="amzn-ami-vpc-nat*" Name="virtualization-type",Values="hvm"
+data "aws_ec2_instance_type" "nat_instance" {
+  count = local.need_nat_ami_id ? 1 : 0
+
+  instance_type = var.nat_instance_type
+}
+
+# The latest AMI of `nat_instance_ami_family` for the architecture of `nat_instance_type`, see `local.nat_instance_ami_filters`
 data "aws_ami" "nat_instance" {
   count = local.need_nat_ami_id ? 1 : 0
 
@@ -58,7 +125,12 @@ data "aws_ami" "nat_instance" {
 
   filter {
     name   = "name"
-    values = ["amzn-ami-vpc-nat*"]
+    values = [local.nat_instance_ami_filter.name]
+  }
+
+  filter {
+    name   = "architecture"
+    values = [local.nat_instance_architecture]
   }
 
   filter {
@@ -66,24 +138,34 @@ data "aws_ami" "nat_instance" {
     values = ["hvm"]
   }
 
-  owners = ["amazon"]
+  owners = [local.nat_instance_ami_filter.owner]
+
+  lifecycle {
+    precondition {
+      condition     = !(var.nat_instance_ami_family == "amzn-ami-vpc-nat" && local.nat_instance_architecture == "arm64")
+      error_message = "The `amzn-ami-vpc-nat` AMI is only available for x86_64 instance types. Use another `nat_instance_ami_family` for ${var.nat_instance_type}."
+    }
+  }
 }
 
 # https://docs.aws.amazon.com/vpc/latest/userguide/vpc-nat-comparison.html
 # https://docs.aws.amazon.com/vpc/latest/userguide/VPC_NAT_Instance.html
 # https://dzone.com/articles/nat-instance-vs-nat-gateway
 resource "aws_instance" "nat_instance" {
-  count = local.nat_instance_enabled ? local.nat_count : 0
+  for_each = local.nat_instance_standalone_enabled ? local.nat_key_to_index_map : {}
 
   ami                    = local.nat_instance_ami_id
   instance_type          = var.nat_instance_type
-  subnet_id              = aws_subnet.public[local.nat_gateway_public_subnet_indices[count.index]].id
-  vpc_security_group_ids = [aws_security_group.nat_instance[0].id]
+  subnet_id              = aws_subnet.public[each.key].id
+  vpc_security_group_ids = local.nat_instance_security_group_ids
+  user_data              = lookup(local.nat_instance_user_data, each.key, null)
+  ipv6_address_count     = local.nat_instance_nat64_enabled ? 1 : null
+  iam_instance_profile   = local.nat_instance_iam_instance_profile_name
 
   tags = merge(
     module.nat_instance_label.tags,
     {
-      "Name" = format("%s%s%s", module.nat_instance_label.id, local.delimiter, local.public_subnet_az_abbreviations[local.nat_gateway_public_subnet_indices[count.index]])
+      "Name" = format("%s%s%s", module.nat_instance_label.id, local.delimiter, local.public_subnet_az_abbreviations[local.nat_gateway_public_subnet_indices[each.value]])
     }
   )
 
@@ -106,6 +188,21 @@ resource "aws_instance" "nat_instance" {
     encrypted = local.nat_instance_root_block_device_encrypted
   }
 
+  dynamic "instance_market_options" {
+    for_each = local.nat_instance_spot_enabled ? [local.nat_instance_spot_interruption_behavior] : []
+
+    content {
+      market_type = "spot"
+
+      spot_options {
+        max_price                      = var.nat_instance_spot.max_price
+        instance_interruption_behavior = instance_market_options.value
+        # Only persistent requests can stop the instance, and restart it when capacity is available
+        spot_instance_type = instance_market_options.value == "terminate" ? "one-time" : "persistent"
+      }
+    }
+  }
+
   dynamic "credit_specification" {
     for_each = var.nat_instance_cpu_credits_override == "" ? [] : [var.nat_instance_cpu_credits_override]
 
@@ -118,20 +215,20 @@ resource "aws_instance" "nat_instance" {
 }
 
 resource "aws_eip_association" "nat_instance" {
-  count = local.nat_instance_enabled ? local.nat_count : 0
+  for_each = local.nat_instance_standalone_enabled ? local.nat_key_to_index_map : {}
 
-  instance_id   = aws_instance.nat_instance[count.index].id
-  allocation_id = local.nat_eip_allocations[count.index]
+  instance_id   = aws_instance.nat_instance[each.key].id
+  allocation_id = local.nat_eip_allocations[each.value]
 }
 
 # If private IPv4 subnets and NAT Instance are both enabled, create a
 # default route from private subnet to NAT Instance in each subnet
 # Each private subnet routes to a NAT in its own AZ
 resource "aws_route" "nat_instance" {
-  count = local.nat_instance_enabled ? local.private_route_table_count : 0
+  for_each = local.nat_instance_standalone_enabled && local.private4_enabled ? local.private_route_table_key_to_index_map : {}
 
-  route_table_id         = local.private_route_table_ids[count.index]
-  network_interface_id   = aws_instance.nat_instance[local.private_route_table_to_nat_map[count.index]].primary_network_interface_id
+  route_table_id         = aws_route_table.private[each.key].id
+  network_interface_id   = aws_instance.nat_instance[local.nat_keys[local.private_route_table_to_nat_map[each.value]]].primary_network_interface_id
   destination_cidr_block = "0.0.0.0/0"
   depends_on             = [aws_route_table.private]
 
@@ -140,3 +237,271 @@ resource "aws_route" "nat_instance" {
     delete = local.route_delete_timeout
   }
 }
+
+# If private IPv6 subnets need NAT64 and the NAT instances perform it, create a
+# NAT64 route from private subnet to NAT Instance in each subnet
+# Each private subnet routes to a NAT in its own AZ
+resource "aws_route" "nat_instance_nat64" {
+  for_each = local.nat_instance_standalone_enabled && local.private_nat_instance_nat64_enabled ? local.private_route_table_key_to_index_map : {}
+
+  route_table_id              = aws_route_table.private[each.key].id
+  network_interface_id        = aws_instance.nat_instance[local.nat_keys[local.private_route_table_to_nat_map[each.value]]].primary_network_interface_id
+  destination_ipv6_cidr_block = local.nat64_cidr
+  depends_on                  = [aws_route_table.private]
+
+  timeouts {
+    create = local.route_create_timeout
+    delete = local.route_delete_timeout
+  }
+}
+
+# The instance role of the NAT instances. It allows them to take over from their predecessors in their Auto Scaling groups,
+# to publish metrics, and to be managed with Session Manager and the CloudWatch agent, as configured.
+data "aws_partition" "current" {
+  count = length(local.nat_instance_iam_managed_policies) > 0 || local.nat_instance_asg_enabled ? 1 : 0
+}
+
+data "aws_iam_policy_document" "nat_instance_assume_role" {
+  count = local.nat_instance_iam_role_enabled ? 1 : 0
+
+  statement {
+    actions = ["sts:AssumeRole"]
+
+    principals {
+      type        = "Service"
+      identifiers = ["ec2.amazonaws.com"]
+    }
+  }
+}
+
+data "aws_iam_policy_document" "nat_instance" {
+  count = local.nat_instance_iam_policy_enabled ? 1 : 0
+
+  dynamic "statement" {
+    for_each = local.nat_instance_asg_enabled ? ["TakeOverElasticIps"] : []
+
+    content {
+      sid       = statement.value
+      actions   = ["ec2:AssociateAddress"]
+      resources = [for a in local.nat_eip_allocations : format("arn:%s:ec2:*:*:elastic-ip/%s", data.aws_partition.current[0].partition, a)]
+    }
+  }
+
+  # The instances are only known by the Name tags their launch templates give them
+  dynamic "statement" {
+    for_each = local.nat_instance_asg_enabled ? ["TakeOverInstances"] : []
+
+    content {
+      sid       = statement.value
+      actions   = ["ec2:AssociateAddress", "ec2:ModifyInstanceAttribute"]
+      resources = [format("arn:%s:ec2:*:*:instance/*", data.aws_partition.current[0].partition)]
+
+      condition {
+        test     = "StringEquals"
+        variable = "aws:ResourceTag/Name"
+        values   = values(local.nat_instance_asg_names)
+      }
+    }
+  }
+
+  # An instance that fails to take over marks itself unhealthy, so that its Auto Scaling group replaces it
+  dynamic "statement" {
+    for_each = local.nat_instance_asg_enabled ? ["ReportUnhealthy"] : []
+
+    content {
+      sid     = statement.value
+      actions = ["autoscaling:SetInstanceHealth"]
+      resources = [
+        for name in values(local.nat_instance_asg_names) : format("arn:%s:autoscaling:*:*:autoScalingGroup:*:autoScalingGroupName/%s", data.aws_partition.current[0].partition, name)
+      ]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = local.nat_instance_asg_enabled ? ["Routes"] : []
+
+    content {
+      sid       = statement.value
+      actions   = ["ec2:CreateRoute", "ec2:ReplaceRoute"]
+      resources = distinct(flatten([for rts in concat(values(local.nat_instance_route_tables), values(local.nat_instance_nat64_route_tables)) : rts[*].arn]))
+    }
+  }
+
+  dynamic "statement" {
+    for_each = local.nat_instance_metrics_enabled ? ["Metrics"] : []
+
+    content {
+      sid       = statement.value
+      actions   = ["cloudwatch:PutMetricData"]
+      resources = ["*"]
+
+      condition {
+        test     = "StringEquals"
+        variable = "cloudwatch:namespace"
+        values   = [local.nat_instance_metrics_namespace]
+      }
+    }
+  }
+}
+
+resource "aws_iam_role" "nat_instance" {
+  count = local.nat_instance_iam_role_enabled ? 1 : 0
+
+  name               = module.nat_instance_label.id
+  assume_role_policy = data.aws_iam_policy_document.nat_instance_assume_role[0].json
+  tags               = module.nat_instance_label.tags
+}
+
+resource "aws_iam_role_policy" "nat_instance" {
+  count = local.nat_instance_iam_policy_enabled ? 1 : 0
+
+  name   = module.nat_instance_label.id
+  role   = aws_iam_role.nat_instance[0].id
+  policy = data.aws_iam_policy_document.nat_instance[0].json
+}
+
+resource "aws_iam_role_policy_attachment" "nat_instance" {
+  for_each = toset(local.nat_instance_iam_managed_policies)
+
+  role       = aws_iam_role.nat_instance[0].name
+  policy_arn = format("arn:%s:iam::aws:policy/%s", data.aws_partition.current[0].partition, each.key)
+}
+
+resource "aws_iam_instance_profile" "nat_instance" {
+  count = local.nat_instance_iam_role_enabled ? 1 : 0
+
+  name = module.nat_instance_label.id
+  role = aws_iam_role.nat_instance[0].name
+  tags = module.nat_instance_label.tags
+}
+
+# Self-healing NAT instances: each NAT instance runs in an Auto Scaling group of size 1 in its AZ.
+# The instance associates its Elastic IP and takes over the routes to the NAT instance itself when it boots.
+
+resource "aws_launch_template" "nat_instance" {
+  for_each = local.nat_instance_asg_enabled ? local.nat_key_to_index_map : {}
+
+  name          = local.nat_instance_asg_names[each.key]
+  image_id      = local.nat_instance_ami_id
+  instance_type = var.nat_instance_type
+  user_data     = base64encode(local.nat_instance_user_data[each.key])
+  ebs_optimized = true
+
+  iam_instance_profile {
+    name = local.nat_instance_iam_instance_profile_name
+  }
+
+  network_interfaces {
+    device_index                = 0
+    associate_public_ip_address = true #tfsec:ignore:AWS012
+    ipv6_address_count          = local.nat_instance_nat64_enabled ? 1 : null
+    delete_on_termination       = true
+    security_groups             = local.nat_instance_security_group_ids
+  }
+
+  metadata_options {
+    http_endpoint               = var.metadata_http_endpoint_enabled ? "enabled" : "disabled"
+    http_put_response_hop_limit = var.metadata_http_put_response_hop_limit
+    http_tokens                 = var.metadata_http_tokens_required ? "required" : "optional"
+  }
+
+  block_device_mappings {
+    device_name = try(data.aws_ami.nat_instance[0].root_device_name, "/dev/xvda")
+
+    ebs {
+      encrypted = local.nat_instance_root_block_device_encrypted
+    }
+  }
+
+  dynamic "credit_specification" {
+    for_each = var.nat_instance_cpu_credits_override == "" ? [] : [var.nat_instance_cpu_credits_override]
+
+    content {
+      cpu_credits = var.nat_instance_cpu_credits_override
+    }
+  }
+
+  tag_specifications {
+    resource_type = "instance"
+    tags = merge(
+      module.nat_instance_label.tags,
+      {
+        "Name" = local.nat_instance_asg_names[each.key]
+      }
+    )
+  }
+
+  tags = module.nat_instance_label.tags
+}
+
+resource "aws_autoscaling_group" "nat_instance" {
+  for_each = local.nat_instance_asg_enabled ? local.nat_key_to_index_map : {}
+
+  name                = aws_launch_template.nat_instance[each.key].name
+  min_size            = 1
+  max_size            = 1
+  desired_capacity    = 1
+  vpc_zone_identifier = [aws_subnet.public[each.key].id]
+
+  dynamic "launch_template" {
+    for_each = local.nat_instance_spot_enabled ? [] : [aws_launch_template.nat_instance[each.key]]
+
+    content {
+      id      = launch_template.value.id
+      version = launch_template.value.latest_version
+    }
+  }
+
+  # Spot NAT instances are requested by the Auto Scaling group, which replaces them when they are interrupted
+  dynamic "mixed_instances_policy" {
+    for_each = local.nat_instance_spot_enabled ? [aws_launch_template.nat_instance[each.key]] : []
+
+    content {
+      instances_distribution {
+        on_demand_base_capacity                  = 0
+        on_demand_percentage_above_base_capacity = 0
+        spot_allocation_strategy                 = "price-capacity-optimized"
+        spot_max_price                           = var.nat_instance_spot.max_price
+      }
+
+      launch_template {
+        launch_template_specification {
+          launch_template_id = mixed_instances_policy.value.id
+          version            = mixed_instances_policy.value.latest_version
+        }
+      }
+    }
+  }
+
+  # Replace the NAT instance when the launch template changes. There is only one instance,
+  # so there is a short interruption while the new instance takes over.
+  instance_refresh {
+    strategy = "Rolling"
+    preferences {
+      min_healthy_percentage = 0
+    }
+  }
+
+  dynamic "tag" {
+    for_each = merge(module.nat_instance_label.tags, { "Name" = aws_launch_template.nat_instance[each.key].name })
+
+    content {
+      key                 = tag.key
+      value               = tag.value
+      propagate_at_launch = false
+    }
+  }
+
+  lifecycle {
+    precondition {
+      condition     = var.metadata_http_endpoint_enabled
+      error_message = "NAT instances in Auto Scaling groups need the instance metadata service to take over from their predecessors. Set `metadata_http_endpoint_enabled` to `true`."
+    }
+    precondition {
+      condition     = !local.nat_instance_spot_enabled || var.nat_instance_spot.interruption_behavior != "stop"
+      error_message = "Spot NAT instances in Auto Scaling groups are terminated and replaced when interrupted, they cannot be stopped. Set `nat_instance_spot.interruption_behavior` to \"terminate\", or leave it unset."
+    }
+  }
+
+  depends_on = [aws_iam_role_policy.nat_instance]
+}
@@ -0,0 +1,77 @@
+# Network ACLs for the subnets named in `named_network_acl_rules`, separate from the network ACL of their tier
+resource "aws_network_acl" "named" {
+  for_each = local.named_network_acls
+
+  vpc_id     = local.vpc_id
+  subnet_ids = [for k in each.value.subnet_keys : local.tier_subnet_id_map[each.value.tier][k]]
+
+  tags = merge(
+    local.tier_label_tags[each.value.tier],
+    {
+      "Name" = format("%s%s%s", local.tier_label_ids[each.value.tier], local.delimiter, each.value.name)
+    }
+  )
+
+  lifecycle {
+    precondition {
+      condition     = length(each.value.subnet_keys) > 0
+      error_message = "`named_network_acl_rules` lists `${each.key}`, but the `${each.value.tier}` tier has no subnets with that name."
+    }
+    precondition {
+      condition     = !contains(keys(local.named_supplied_network_acls), each.key)
+      error_message = "`${each.key}` is in both `named_network_acl_rules` and `named_network_acl_ids`."
+    }
+  }
+}
+
+# Rules configured via `network_acl_rules` and `named_network_acl_rules`, in the network ACL of each tier or named subnet
+resource "aws_network_acl_rule" "rules" {
+  for_each = local.network_acl_rules
+
+  network_acl_id = try(local.network_acl_id_map[each.value.acl], "")
+  rule_action    = each.value.rule_action
+  rule_number    = each.value.rule_number
+
+  egress          = each.value.egress
+  cidr_block      = each.value.cidr_block
+  ipv6_cidr_block = each.value.ipv6_cidr_block
+  from_port       = each.value.from_port
+  to_port         = each.value.to_port
+  protocol        = each.value.protocol
+  icmp_type       = each.value.icmp_type
+  icmp_code       = each.value.icmp_code
+
+  lifecycle {
+    precondition {
+      condition     = length(local.network_acl_rule_invalid_tiers) == 0
+      error_message = "Unknown subnet tiers in `network_acl_rules` or `named_network_acl_rules`: ${join(", ", local.network_acl_rule_invalid_tiers)}. Use `private`, `public`, `intra`, or a key of `subnet_tiers`."
+    }
+    precondition {
+      condition     = !each.value.open_rule_collision
+      error_message = "Network ACL rule `${each.key}` has the number of an open rule. Change its `rule_number`, or `open_network_acl_ipv4_rule_number` or `open_network_acl_ipv6_rule_number`."
+    }
+    precondition {
+      condition     = !contains(local.supplied_network_acl_tiers, each.value.acl)
+      error_message = "The subnets of the `${each.value.acl}` tier all use supplied network ACLs (`public_network_acl_ids`, `private_network_acl_ids` or `named_network_acl_ids`), so the module does not manage their rules."
+    }
+    precondition {
+      condition     = length(local.network_acl_preset_trusted_overflow) == 0
+      error_message = "The presets number the rules for trusted sources from 1000 to 1099, so they trust at most ${local.network_acl_preset_rule_block_size} CIDRs, but the `${join("`, `", local.network_acl_preset_trusted_overflow)}` network ACL(s) trust more. Shorten `trusted_ipv4_cidrs` and `trusted_ipv6_cidrs`, or list the rules without a preset."
+    }
+  }
+}
+
+# Subnets associated with existing network ACLs, from `public_network_acl_ids`, `private_network_acl_ids` and `named_network_acl_ids`
+resource "aws_network_acl_association" "default" {
+  for_each = local.supplied_network_acl_associations
+
+  network_acl_id = each.value.network_acl_id
+  subnet_id      = try(local.tier_subnet_id_map[each.value.tier][each.value.subnet_key], "")
+
+  lifecycle {
+    precondition {
+      condition     = length(local.supplied_network_acl_errors) == 0
+      error_message = join(" ", local.supplied_network_acl_errors)
+    }
+  }
+}
@@ -12,22 +12,32 @@ output "availability_zone_ids" {
 
 output "public_subnet_ids" {
   description = "IDs of the created public subnets"
-  value       = aws_subnet.public[*].id
+  value       = local.public_subnet_list[*].id
 }
 
 output "public_subnet_arns" {
   description = "ARNs of the created public subnets"
-  value       = aws_subnet.public[*].arn
+  value       = local.public_subnet_list[*].arn
 }
 
 output "private_subnet_ids" {
   description = "IDs of the created private subnets"
-  value       = aws_subnet.private[*].id
+  value       = local.private_subnet_list[*].id
 }
 
 output "private_subnet_arns" {
   description = "ARNs of the created private subnets"
-  value       = aws_subnet.private[*].arn
+  value       = local.private_subnet_list[*].arn
+}
+
+output "intra_subnet_ids" {
+  description = "IDs of the created intra subnets"
+  value       = local.intra_subnet_list[*].id
+}
+
+output "intra_subnet_arns" {
+  description = "ARNs of the created intra subnets"
+  value       = local.intra_subnet_list[*].arn
 }
 
 # Provide some consistency in CIDR outputs by always returning a list.
@@ -35,57 +45,97 @@ output "private_subnet_arns" {
 # value via configuration rather than computing it via `compact()`.
 output "public_subnet_cidrs" {
   description = "IPv4 CIDR blocks of the created public subnets"
-  value       = local.public4_enabled ? aws_subnet.public[*].cidr_block : []
+  value       = local.public4_enabled ? local.public_subnet_list[*].cidr_block : []
 }
 
 output "public_subnet_ipv6_cidrs" {
   description = "IPv6 CIDR blocks of the created public subnets"
-  value       = local.public6_enabled ? aws_subnet.public[*].ipv6_cidr_block : []
+  value       = local.public6_enabled ? local.public_subnet_list[*].ipv6_cidr_block : []
 }
 
 output "private_subnet_cidrs" {
   description = "IPv4 CIDR blocks of the created private subnets"
-  value       = local.private4_enabled ? aws_subnet.private[*].cidr_block : []
+  value       = local.private4_enabled ? local.private_subnet_list[*].cidr_block : []
 }
 
 output "private_subnet_ipv6_cidrs" {
   description = "IPv6 CIDR blocks of the created private subnets"
-  value       = local.private6_enabled ? aws_subnet.private[*].ipv6_cidr_block : []
+  value       = local.private6_enabled ? local.private_subnet_list[*].ipv6_cidr_block : []
+}
+
+output "intra_subnet_cidrs" {
+  description = "IPv4 CIDR blocks of the created intra subnets"
+  value       = local.intra4_enabled ? local.intra_subnet_list[*].cidr_block : []
+}
+
+output "intra_subnet_ipv6_cidrs" {
+  description = "IPv6 CIDR blocks of the created intra subnets"
+  value       = local.intra6_enabled ? local.intra_subnet_list[*].ipv6_cidr_block : []
 }
 
 output "public_route_table_ids" {
   description = "IDs of the created public route tables"
-  value       = aws_route_table.public[*].id
+  value       = local.created_public_route_table_ids
 }
 
 output "private_route_table_ids" {
   description = "IDs of the created private route tables"
-  value       = aws_route_table.private[*].id
+  value       = local.private_route_table_ids
+}
+
+output "intra_route_table_ids" {
+  description = "IDs of the created intra route tables"
+  value       = local.intra_route_table_ids
 }
 
 output "public_network_acl_id" {
   description = "ID of the Network ACL created for public subnets"
-  value       = local.public_open_network_acl_enabled ? aws_network_acl.public[0].id : null
+  value       = local.public_network_acl_enabled ? aws_network_acl.public[0].id : null
 }
 
 output "private_network_acl_id" {
   description = "ID of the Network ACL created for private subnets"
-  value       = local.private_open_network_acl_enabled ? aws_network_acl.private[0].id : null
+  value       = local.private_network_acl_enabled ? aws_network_acl.private[0].id : null
+}
+
+output "intra_network_acl_id" {
+  description = "ID of the Network ACL created for intra subnets"
+  value       = local.intra_network_acl_enabled ? aws_network_acl.intra[0].id : null
 }
 
 output "nat_gateway_ids" {
   description = "IDs of the NAT Gateways created"
-  value       = aws_nat_gateway.default[*].id
+  value       = local.nat_gateway_list[*].id
 }
 
 output "nat_gateway_private_ips" {
   description = "Private IP addresses of the NAT Gateways"
-  value       = aws_nat_gateway.default[*].private_ip
+  value       = local.nat_gateway_list[*].private_ip
+}
+
+output "private_nat_gateway_ids" {
+  description = "IDs of the private NAT Gateways created, in AZ order"
+  value       = [for k in local.private_nat_gateway_keys : aws_nat_gateway.private[k].id]
+}
+
+output "private_nat_gateway_private_ips" {
+  description = "Private IP addresses of the private NAT Gateways, in AZ order"
+  value       = [for k in local.private_nat_gateway_keys : aws_nat_gateway.private[k].private_ip]
 }
 
 output "nat_instance_ids" {
-  description = "IDs of the NAT Instances created"
-  value       = aws_instance.nat_instance[*].id
+  description = "IDs of the NAT Instances created. Empty when the NAT Instances run in Auto Scaling groups."
+  value       = local.nat_instance_list[*].id
+}
+
+output "nat_instance_autoscaling_group_names" {
+  description = "Names of the Auto Scaling groups running the NAT Instances, one per NAT, when `nat_instance_auto_scaling_group_enabled` is `true`"
+  value       = [for k in local.nat_keys : aws_autoscaling_group.nat_instance[k].name if local.nat_instance_asg_enabled]
+}
+
+output "nat_instance_iam_role_name" {
+  description = "Name of the IAM role of the NAT Instances, if the module created one"
+  value       = one(aws_iam_role.nat_instance[*].name)
 }
 
 output "nat_instance_ami_id" {
@@ -94,13 +144,33 @@ output "nat_instance_ami_id" {
 }
 
 output "nat_ips" {
-  description = "Elastic IP Addresses in use by NAT"
-  value       = local.need_nat_eip_data ? var.nat_elastic_ips : aws_eip.default[*].public_ip
+  description = "Elastic IP Addresses in use by NAT. These are the primary Elastic IPs only: see `nat_gateway_ips_map` for the secondary ones"
+  value       = local.need_nat_eip_data ? local.nat_supplied_primary_eips : local.nat_eip_list[*].public_ip
 }
 
 output "nat_eip_allocation_ids" {
-  description = "Elastic IP allocations in use by NAT"
-  value       = local.nat_eip_allocations
+  description = "Elastic IP allocations in use by NAT. These are the primary Elastic IPs only: see `nat_gateway_eip_allocation_ids_map` for the secondary ones"
+  value       = local.need_nat_eip_data ? slice(local.nat_eip_allocations, 0, length(local.nat_supplied_primary_eips)) : local.nat_eip_allocations
+}
+
+output "nat_gateway_ips_map" {
+  description = "Map of the keys of the NAT Gateways (the key of the public subnet each is in, such as `use2a/common`) to the Elastic IP Addresses of each NAT Gateway, primary first"
+  value       = local.nat_gateway_ips_map
+}
+
+output "nat_gateway_eip_allocation_ids_map" {
+  description = "Map of the keys of the NAT Gateways (the key of the public subnet each is in, such as `use2a/common`) to the Elastic IP allocations of each NAT Gateway, primary first"
+  value       = local.nat_gateway_eip_allocation_ids_map
+}
+
+output "transit_gateway_vpc_attachment_id" {
+  description = "ID of the Transit Gateway VPC attachment, or `null` if none was created"
+  value       = local.transit_gateway_attachment_enabled ? aws_ec2_transit_gateway_vpc_attachment.default[0].id : null
+}
+
+output "transit_gateway_attachment_subnet_ids" {
+  description = "IDs of the subnets used by the Transit Gateway VPC attachment, one per AZ"
+  value       = local.transit_gateway_attachment_subnet_ids
 }
 
 output "az_private_subnets_map" {
@@ -123,6 +193,16 @@ output "az_public_route_table_ids_map" {
   value       = local.az_public_route_table_ids_map
 }
 
+output "az_intra_subnets_map" {
+  description = "Map of AZ names to list of intra subnet IDs in the AZs"
+  value       = local.az_intra_subnets_map
+}
+
+output "az_intra_route_table_ids_map" {
+  description = "Map of AZ names to list of intra route table IDs in the AZs"
+  value       = local.az_intra_route_table_ids_map
+}
+
 output "named_private_subnets_map" {
   description = "Map of subnet names (specified in `private_subnets_per_az_names` or `subnets_per_az_names` variable) to lists of private subnet IDs"
   value       = local.named_private_subnets_map
@@ -143,12 +223,134 @@ output "named_public_route_table_ids_map" {
   value       = local.named_public_route_table_ids_map
 }
 
+output "named_private_network_acl_ids_map" {
+  description = "Map of subnet names (specified in `private_subnets_per_az_names` or `subnets_per_az_names` variable) to the ID of the network ACL of the private subnets with that name"
+  value       = lookup(local.named_tier_network_acl_ids_map, "private", {})
+}
+
+output "named_public_network_acl_ids_map" {
+  description = "Map of subnet names (specified in `public_subnets_per_az_names` or `subnets_per_az_names` variable) to the ID of the network ACL of the public subnets with that name"
+  value       = lookup(local.named_tier_network_acl_ids_map, "public", {})
+}
+
+output "named_intra_subnets_map" {
+  description = "Map of subnet names (specified in `intra_subnets_per_az_names` or `subnets_per_az_names` variable) to lists of intra subnet IDs"
+  value       = local.named_intra_subnets_map
+}
+
+output "named_intra_route_table_ids_map" {
+  description = "Map of subnet names (specified in `intra_subnets_per_az_names` or `subnets_per_az_names` variable) to lists of intra route table IDs"
+  value       = local.named_intra_route_table_ids_map
+}
+
 output "named_private_subnets_stats_map" {
   description = "Map of subnet names (specified in `private_subnets_per_az_names` or `subnets_per_az_names` variable) to lists of objects with each object having four items: AZ, private subnet ID, private route table ID, NAT Gateway ID (the NAT Gateway that this private subnet routes to for egress)"
   value       = local.named_private_subnets_stats_map
 }
 
+output "az_interface_vpc_endpoints_map" {
+  description = <<-EOT
+    Map of the keys of `interface_vpc_endpoints` to maps of Availability Zone to objects with the endpoint ID (`vpc_endpoint_id`),
+    the subnet the endpoint uses in that AZ (`subnet_id`), and the endpoint's DNS names specific to that AZ (`dns_names`)
+    EOT
+  value       = local.az_interface_vpc_endpoints_map
+}
+
 output "named_public_subnets_stats_map" {
   description = "Map of subnet names (specified in `public_subnets_per_az_names` or `subnets_per_az_names` variable) to lists of objects with each object having four items: AZ, public subnet ID, public route table ID, NAT Gateway ID (the NAT Gateway in this public subnet, if any)"
   value       = local.named_public_subnets_stats_map
 }
+
+output "named_intra_subnets_stats_map" {
+  description = "Map of subnet names (specified in `intra_subnets_per_az_names` or `subnets_per_az_names` variable) to lists of objects with each object having three items: AZ, intra subnet ID, intra route table ID"
+  value       = local.named_intra_subnets_stats_map
+}
+
+output "tier_subnet_ids" {
+  description = "Map of subnet tier name to the IDs of the subnets in that tier, including the built-in `public`, `private`, and `intra` tiers (an empty list when the tier is disabled)"
+  value       = local.tier_subnet_ids
+}
+
+output "tier_subnet_cidrs" {
+  description = "Map of subnet tier name to the IPv4 CIDR blocks of the subnets in that tier"
+  value       = local.tier_subnet_cidrs
+}
+
+output "tier_subnet_ipv6_cidrs" {
+  description = "Map of subnet tier name to the IPv6 CIDR blocks of the subnets in that tier"
+  value       = local.tier_subnet_ipv6_cidrs
+}
+
+output "tier_route_table_ids" {
+  description = "Map of subnet tier name to the IDs of the route tables in that tier, with a key for every tier (an empty list when the tier is disabled)"
+  value       = local.tier_route_table_ids
+}
+
+output "tier_network_acl_ids" {
+  description = "Map of subnet tier name to the ID of the network ACL created for that tier, or `null` if none was created"
+  value       = local.tier_network_acl_ids
+}
+
+output "az_tier_subnets_map" {
+  description = "Map of subnet tier name to a map of Availability Zone to the list of subnet IDs of that tier in that AZ"
+  value       = local.az_tier_subnets_map
+}
+
+output "named_tier_subnets_map" {
+  description = "Map of subnet tier name to a map of subnet name to the list of subnet IDs with that name, one per AZ"
+  value       = local.named_tier_subnets_map
+}
+
+output "named_tier_route_table_ids_map" {
+  description = "Map of subnet tier name to a map of subnet name to the list of route table IDs for subnets with that name, one per AZ"
+  value       = local.named_tier_route_table_ids_map
+}
+
+output "named_tier_network_acl_ids_map" {
+  description = <<-EOT
+    Map of subnet tier name to a map of subnet name to the ID of the network ACL of the subnets with that name:
+    their own network ACL from `named_network_acl_rules`, if any, otherwise the network ACL of the tier, or `null` if none was created
+    EOT
+  value       = local.named_tier_network_acl_ids_map
+}
+
+output "count_to_for_each_state_moves" {
+  description = <<-EOT
+    Map of the addresses these resources had when earlier versions of this module created them with `count`
+    (e.g. `aws_subnet.private[0]`) to their current `for_each` addresses (e.g. `aws_subnet.private["use2a/app"]`),
+    for generating the `terraform state mv` commands that upgrading to v3.0 requires. See `docs/migration-v2-v3.md`.
+    EOT
+  value       = local.count_to_for_each_state_moves
+}
+
+output "gateway_vpc_endpoint_ids" {
+  description = "Map of the keys of `gateway_vpc_endpoints` to the IDs of the gateway VPC endpoints"
+  value       = { for k, v in aws_vpc_endpoint.gateway : k => v.id }
+}
+
+output "gateway_vpc_endpoint_prefix_list_ids" {
+  description = "Map of the keys of `gateway_vpc_endpoints` to the IDs of the prefix lists of the services, for use in security group rules"
+  value       = { for k, v in aws_vpc_endpoint.gateway : k => v.prefix_list_id }
+}
+
+output "interface_vpc_endpoint_ids" {
+  description = "Map of the keys of `interface_vpc_endpoints` to the IDs of the interface VPC endpoints"
+  value       = { for k, v in aws_vpc_endpoint.interface : k => v.id }
+}
+
+output "interface_vpc_endpoint_dns_entries" {
+  description = "Map of the keys of `interface_vpc_endpoints` to the DNS entries (`dns_name` and `hosted_zone_id`) of the interface VPC endpoints"
+  value       = { for k, v in aws_vpc_endpoint.interface : k => v.dns_entry }
+}
+
+output "interface_vpc_endpoint_security_group_id" {
+  description = "The ID of the security group created for the interface VPC endpoints, or `null` if none was created"
+  value       = one(aws_security_group.interface_vpc_endpoint[*].id)
+}
+
+output "additional_route_table_ids" {
+  description = "Map of the keys of `additional_routes` to the IDs of the route tables each route was added to"
+  value = { for name in keys(var.additional_routes) : name => [
+    for k, r in local.additional_routes : aws_route.additional[k].route_table_id if r.name == name
+  ] if local.e }
+}
@@ -2,29 +2,29 @@ module "private_label" {
   source  = "cloudposse/label/null"
   version = "0.25.0"
 
-  attributes = [var.private_label]
+  attributes = [local.subnet_tiers.private.label]
   tags = merge(
-    var.private_subnets_additional_tags,
-    var.subnet_type_tag_key != null && var.subnet_type_tag_value_format != null ? { (var.subnet_type_tag_key) = format(var.subnet_type_tag_value_format, var.private_label) } : {}
+    local.subnet_tiers.private.additional_tags,
+    var.subnet_type_tag_key != null && var.subnet_type_tag_value_format != null ? { (var.subnet_type_tag_key) = format(var.subnet_type_tag_value_format, local.subnet_tiers.private.label) } : {}
   )
 
   context = module.this.context
 }
 
 resource "aws_subnet" "private" {
-  count = local.private_enabled ? local.private_subnet_az_count : 0
+  for_each = local.private_subnet_key_to_index_map
 
   vpc_id            = local.vpc_id
-  availability_zone = local.private_subnet_availability_zones[count.index]
+  availability_zone = local.private_subnet_availability_zones[each.value]
 
-  cidr_block      = local.private4_enabled ? local.ipv4_private_subnet_cidrs[count.index] : null
-  ipv6_cidr_block = local.private6_enabled ? local.ipv6_private_subnet_cidrs[count.index] : null
+  cidr_block      = local.private4_enabled ? local.ipv4_private_subnet_cidrs[each.value] : null
+  ipv6_cidr_block = local.private6_enabled ? local.ipv6_private_subnet_cidrs[each.value] : null
   ipv6_native     = local.private6_enabled && !local.private4_enabled
 
   tags = merge(
     module.private_label.tags,
     {
-      "Name" = format("%s%s%s", module.private_label.id, local.delimiter, local.private_subnet_az_abbreviations[count.index])
+      "Name" = format("%s%s%s", module.private_label.id, local.delimiter, local.private_subnet_az_abbreviations[each.value])
     }
   )
 
@@ -49,22 +49,22 @@ resource "aws_subnet" "private" {
 
 resource "aws_route_table" "private" {
   # One route table per private subnet
-  count = local.private_route_table_count
+  for_each = local.private_route_table_key_to_index_map
 
   vpc_id = local.vpc_id
 
   tags = merge(
     module.private_label.tags,
     {
-      "Name" = format("%s%s%s", module.private_label.id, local.delimiter, local.private_subnet_az_abbreviations[count.index])
+      "Name" = format("%s%s%s", module.private_label.id, local.delimiter, local.private_subnet_az_abbreviations[each.value])
     }
   )
 }
 
 resource "aws_route" "private6" {
-  count = local.ipv6_egress_only_configured ? local.private_route_table_count : 0
+  for_each = local.private_egress_only6_enabled ? local.private_route_table_key_to_index_map : {}
 
-  route_table_id              = local.private_route_table_ids[count.index]
+  route_table_id              = aws_route_table.private[each.key].id
   destination_ipv6_cidr_block = "::/0"
   egress_only_gateway_id      = var.ipv6_egress_only_igw_id[0]
 
@@ -75,18 +75,17 @@ resource "aws_route" "private6" {
 }
 
 resource "aws_route_table_association" "private" {
-  count = local.private_route_table_enabled ? local.private_subnet_az_count : 0
+  for_each = local.private_route_table_key_to_index_map
 
-  subnet_id = aws_subnet.private[count.index].id
-  # Use element() to "wrap around" and allow for a single table to be associated with all subnets
-  route_table_id = element(local.private_route_table_ids, count.index)
+  subnet_id      = aws_subnet.private[each.key].id
+  route_table_id = aws_route_table.private[each.key].id
 }
 
 resource "aws_network_acl" "private" {
-  count = local.private_open_network_acl_enabled ? 1 : 0
+  count = local.private_network_acl_enabled ? 1 : 0
 
   vpc_id     = local.vpc_id
-  subnet_ids = aws_subnet.private[*].id
+  subnet_ids = [for k in local.private_subnet_keys : aws_subnet.private[k].id if !contains(local.named_network_acl_subnet_keys.private, k)]
 
   tags = module.private_label.tags
 }
@@ -2,25 +2,25 @@ module "public_label" {
   source  = "cloudposse/label/null"
   version = "0.25.0"
 
-  attributes = [var.public_label]
+  attributes = [local.subnet_tiers.public.label]
   tags = merge(
-    var.public_subnets_additional_tags,
-    var.subnet_type_tag_key != null && var.subnet_type_tag_value_format != null ? { (var.subnet_type_tag_key) = format(var.subnet_type_tag_value_format, var.public_label) } : {}
+    local.subnet_tiers.public.additional_tags,
+    var.subnet_type_tag_key != null && var.subnet_type_tag_value_format != null ? { (var.subnet_type_tag_key) = format(var.subnet_type_tag_value_format, local.subnet_tiers.public.label) } : {}
   )
 
   context = module.this.context
 }
 
 resource "aws_subnet" "public" {
-  count = local.public_enabled ? local.public_subnet_az_count : 0
+  for_each = local.public_subnet_key_to_index_map
 
   vpc_id            = local.vpc_id
-  availability_zone = local.public_subnet_availability_zones[count.index]
+  availability_zone = local.public_subnet_availability_zones[each.value]
 
   # When provisioning both public and private subnets, the public subnets get the second set of CIDRs.
   # Use element()'s wrap-around behavior to handle the case where we are only provisioning public subnets.
-  cidr_block      = local.public4_enabled ? element(local.ipv4_public_subnet_cidrs, count.index) : null
-  ipv6_cidr_block = local.public6_enabled ? element(local.ipv6_public_subnet_cidrs, count.index) : null
+  cidr_block      = local.public4_enabled ? element(local.ipv4_public_subnet_cidrs, each.value) : null
+  ipv6_cidr_block = local.public6_enabled ? element(local.ipv6_public_subnet_cidrs, each.value) : null
   ipv6_native     = local.public6_enabled && !local.public4_enabled
 
   #bridgecrew:skip=BC_AWS_NETWORKING_53:Public VPCs should be allowed to default to public IPs
@@ -38,7 +38,7 @@ resource "aws_subnet" "public" {
   tags = merge(
     module.public_label.tags,
     {
-      "Name" = format("%s%s%s", module.public_label.id, local.delimiter, local.public_subnet_az_abbreviations[count.index])
+      "Name" = format("%s%s%s", module.public_label.id, local.delimiter, local.public_subnet_az_abbreviations[each.value])
     }
   )
 
@@ -54,7 +54,7 @@ resource "aws_subnet" "public" {
 
 resource "aws_route_table" "public" {
   # May need 1 table or 1 per AZ
-  count = local.create_public_route_tables ? local.public_route_table_count : 0
+  for_each = local.create_public_route_tables ? local.public_route_table_key_to_index_map : {}
 
   vpc_id = local.vpc_id
 
@@ -62,9 +62,9 @@ resource "aws_route_table" "public" {
 }
 
 resource "aws_route" "public" {
-  count = local.public4_enabled && local.igw_configured ? local.public_route_table_count : 0
+  for_each = local.public4_enabled && local.igw_configured ? local.public_route_table_key_to_index_map : {}
 
-  route_table_id         = local.public_route_table_ids[count.index]
+  route_table_id         = local.public_route_table_ids[each.value]
   destination_cidr_block = "0.0.0.0/0"
   gateway_id             = var.igw_id[0]
 
@@ -75,9 +75,9 @@ resource "aws_route" "public" {
 }
 
 resource "aws_route" "public6" {
-  count = local.public6_enabled && local.igw_configured ? local.public_route_table_count : 0
+  for_each = local.public6_enabled && local.igw_configured ? local.public_route_table_key_to_index_map : {}
 
-  route_table_id              = local.public_route_table_ids[count.index]
+  route_table_id              = local.public_route_table_ids[each.value]
   destination_ipv6_cidr_block = "::/0"
   gateway_id                  = var.igw_id[0]
 
@@ -88,17 +88,18 @@ resource "aws_route" "public6" {
 }
 
 resource "aws_route_table_association" "public" {
-  count = local.public_route_table_enabled ? local.public_subnet_az_count : 0
+  for_each = local.public_route_table_enabled ? local.public_subnet_key_to_index_map : {}
 
-  subnet_id      = aws_subnet.public[count.index].id
-  route_table_id = element(local.public_route_table_ids, count.index)
+  subnet_id = aws_subnet.public[each.key].id
+  # Use element() to "wrap around" and allow for a single table to be associated with all subnets
+  route_table_id = element(local.public_route_table_ids, each.value)
 }
 
 resource "aws_network_acl" "public" {
-  count = local.public_open_network_acl_enabled ? 1 : 0
+  count = local.public_network_acl_enabled ? 1 : 0
 
   vpc_id     = local.vpc_id
-  subnet_ids = aws_subnet.public[*].id
+  subnet_ids = [for k in local.public_subnet_keys : aws_subnet.public[k].id if !contains(local.named_network_acl_subnet_keys.public, k)]
 
   tags = module.public_label.tags
 }
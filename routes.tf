@@ -0,0 +1,29 @@
+# Routes configured via `additional_routes`, in the route tables of a tier or of its named subnets
+resource "aws_route" "additional" {
+  for_each = local.additional_routes
+
+  route_table_id              = try(local.additional_route_table_id_map[each.value.subnet_tier][each.value.route_table_key], "")
+  destination_cidr_block      = each.value.destination_cidr_block
+  destination_ipv6_cidr_block = each.value.destination_ipv6_cidr_block
+  destination_prefix_list_id  = each.value.destination_prefix_list_id
+
+  vpc_peering_connection_id = each.value.vpc_peering_connection_id
+  gateway_id                = each.value.gateway_id
+  transit_gateway_id        = each.value.transit_gateway_id
+  network_interface_id      = each.value.network_interface_id
+  egress_only_gateway_id    = each.value.egress_only_gateway_id
+  vpc_endpoint_id           = each.value.vpc_endpoint_id
+  carrier_gateway_id        = each.value.carrier_gateway_id
+
+  timeouts {
+    create = local.route_create_timeout
+    delete = local.route_delete_timeout
+  }
+
+  lifecycle {
+    precondition {
+      condition     = length(local.additional_route_errors[each.value.name]) == 0
+      error_message = "The route tables for `additional_routes` could not be found: ${join(", ", local.additional_route_errors[each.value.name])}."
+    }
+  }
+}
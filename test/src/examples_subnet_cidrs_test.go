@@ -0,0 +1,144 @@
+package test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	testStructure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+)
+
+// subnetCidrExamples are the examples of computed IPv4 CIDRs that are not all the same size or in the same CIDR block:
+// subnets of different sizes, and subnets in secondary CIDR blocks.
+// Both reserve CIDRs for every AZ in the region (3 in us-east-2), and create no NAT Gateways.
+var subnetCidrExamples = []struct {
+	name   string
+	folder string
+	// The private and public subnet CIDRs expected, in the order of the outputs
+	privateSubnetCidrs []string
+	publicSubnetCidrs  []string
+	// The number of private subnet names, and the name of one of them to check
+	privateSubnetNames int
+	privateSubnetName  string
+}{
+	{
+		// Laid out largest first: 3 eks-nodes /19s, then the 3 app and 3 public /20s,
+		// then the 3 database /27s (20 hosts + 5 reserved by AWS)
+		name:   "VariableSizeSubnets",
+		folder: "examples/variable-size-subnets",
+		privateSubnetCidrs: []string{
+			"172.16.0.0/19", "172.16.96.0/20", "172.16.192.0/27",
+			"172.16.32.0/19", "172.16.112.0/20", "172.16.192.32/27",
+		},
+		publicSubnetCidrs:  []string{"172.16.144.0/20", "172.16.160.0/20"},
+		privateSubnetNames: 3,
+		privateSubnetName:  "database",
+	},
+	{
+		// Each CIDR block is divided up separately: the `app` subnets in 172.17.0.0/16,
+		// the `pods` subnets in 100.64.0.0/16, and the public subnets in the primary CIDR block
+		name:   "SecondaryCidrBlocks",
+		folder: "examples/secondary-cidr-blocks",
+		privateSubnetCidrs: []string{
+			"172.17.0.0/18", "100.64.0.0/18",
+			"172.17.64.0/18", "100.64.64.0/18",
+		},
+		publicSubnetCidrs:  []string{"172.16.0.0/18", "172.16.64.0/18"},
+		privateSubnetNames: 2,
+		privateSubnetName:  "pods",
+	},
+}
+
+// TestExamplesSubnetCidrs tests the computed CIDRs of the private and public subnets
+func TestExamplesSubnetCidrs(t *testing.T) {
+	for _, example := range subnetCidrExamples {
+		t.Run(example.name, func(t *testing.T) {
+			t.Parallel()
+			randID := strings.ToLower(random.UniqueId())
+			attributes := []string{randID}
+
+			rootFolder := "../../"
+			varFiles := []string{"fixtures.us-east-2.tfvars"}
+
+			tempTestFolder := testStructure.CopyTerraformFolderToTemp(t, rootFolder, example.folder)
+
+			terraformOptions := &terraform.Options{
+				// The path to where our Terraform code is located
+				TerraformDir: tempTestFolder,
+				Upgrade:      true,
+				// Variables to pass to our Terraform code using -var-file options
+				VarFiles: varFiles,
+				Vars: map[string]interface{}{
+					"attributes": attributes,
+				},
+			}
+
+			// At the end of the test, run `terraform destroy` to clean up any resources that were created
+			defer cleanup(t, terraformOptions, tempTestFolder)
+
+			// If Go runtime panics, run `terraform destroy` to clean up any resources that were created
+			defer func() {
+				if r := recover(); r != nil {
+					cleanup(t, terraformOptions, tempTestFolder)
+					panic(r) // Re-panic after cleanup
+				}
+			}()
+
+			// This will run `terraform init` and `terraform apply` and fail the test if there are any errors
+			terraform.InitAndApply(t, terraformOptions)
+
+			privateSubnetCidrs := terraform.OutputList(t, terraformOptions, "private_subnet_cidrs")
+			assert.Equal(t, example.privateSubnetCidrs, privateSubnetCidrs)
+
+			publicSubnetCidrs := terraform.OutputList(t, terraformOptions, "public_subnet_cidrs")
+			assert.Equal(t, example.publicSubnetCidrs, publicSubnetCidrs)
+
+			// One subnet per name in each of the 2 AZs used
+			namedPrivateSubnetsMap := terraform.OutputMapOfObjects(t, terraformOptions, "named_private_subnets_map")
+			assert.Equal(t, example.privateSubnetNames, len(namedPrivateSubnetsMap))
+			assert.Equal(t, 2, len(namedPrivateSubnetsMap[example.privateSubnetName].([]interface{})))
+		})
+	}
+}
+
+func TestExamplesSubnetCidrsDisabled(t *testing.T) {
+	for _, example := range subnetCidrExamples {
+		t.Run(example.name, func(t *testing.T) {
+			t.Parallel()
+			randID := strings.ToLower(random.UniqueId())
+			attributes := []string{randID}
+
+			rootFolder := "../../"
+			varFiles := []string{"fixtures.us-east-2.tfvars"}
+
+			tempTestFolder := testStructure.CopyTerraformFolderToTemp(t, rootFolder, example.folder)
+
+			terraformOptions := &terraform.Options{
+				// The path to where our Terraform code is located
+				TerraformDir: tempTestFolder,
+				Upgrade:      true,
+				// Variables to pass to our Terraform code using -var-file options
+				VarFiles: varFiles,
+				Vars: map[string]interface{}{
+					"attributes": attributes,
+					"enabled":    false,
+				},
+			}
+
+			// At the end of the test, run `terraform destroy` to clean up any resources that were created
+			defer cleanup(t, terraformOptions, tempTestFolder)
+
+			// This will run `terraform init` and `terraform apply` and fail the test if there are any errors
+			results := terraform.InitAndApply(t, terraformOptions)
+
+			// Should complete successfully without creating or changing any resources.
+			// Extract the "Resources:" section of the output to make the error message more readable.
+			re := regexp.MustCompile(`Resources: [^.]+\.`)
+			match := re.FindString(results)
+			assert.Equal(t, "Resources: 0 added, 0 changed, 0 destroyed.", match, "Applying with enabled=false should not create any resources")
+		})
+	}
+}
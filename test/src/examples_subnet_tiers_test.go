@@ -0,0 +1,167 @@
+package test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/aws"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	testStructure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+)
+
+// subnetTierExamples are the examples of subnet tiers beyond the public and private subnets:
+// the built-in intra tier, and additional tiers from `subnet_tiers`.
+// Both reserve CIDRs for every AZ in the region (3 in us-east-2), tier by tier.
+var subnetTierExamples = []struct {
+	name   string
+	folder string
+	// NAT Gateways need Elastic IPs, so examples that create them run sequentially to avoid AWS quota limits
+	parallel bool
+	verify   func(t *testing.T, terraformOptions *terraform.Options)
+}{
+	{
+		name:     "IntraSubnets",
+		folder:   "examples/intra-subnets",
+		parallel: true,
+		verify: func(t *testing.T, terraformOptions *terraform.Options) {
+			// intra, in the space left over after private and public
+			intraSubnetCidrs := terraform.OutputList(t, terraformOptions, "intra_subnet_cidrs")
+			assert.Equal(t, []string{"172.16.192.0/20", "172.16.208.0/20"}, intraSubnetCidrs)
+
+			// One route table per intra subnet
+			intraRouteTableIds := terraform.OutputList(t, terraformOptions, "intra_route_table_ids")
+			assert.Equal(t, 2, len(intraRouteTableIds))
+
+			namedIntraSubnetsMap := terraform.OutputMapOfObjects(t, terraformOptions, "named_intra_subnets_map")
+			assert.Equal(t, 1, len(namedIntraSubnetsMap))
+			intraSubnetIds := namedIntraSubnetsMap["database"].([]interface{})
+			assert.Equal(t, 2, len(intraSubnetIds))
+
+			// Intra subnets must not have a route to the Internet Gateway
+			for _, subnetId := range intraSubnetIds {
+				assert.False(t, aws.IsPublicSubnet(t, subnetId.(string), "us-east-2"), "Intra subnet %s should not route to the internet", subnetId)
+			}
+		},
+	},
+	{
+		name:   "SubnetTiers",
+		folder: "examples/subnet-tiers",
+		verify: func(t *testing.T, terraformOptions *terraform.Options) {
+			// The additional tiers, in alphabetical order, in the space left over after private and public
+			tierSubnetCidrs := terraform.OutputMapOfObjects(t, terraformOptions, "tier_subnet_cidrs")
+			assert.Equal(t, []interface{}{"172.16.192.0/21", "172.16.200.0/21"}, tierSubnetCidrs["app"])
+			assert.Equal(t, []interface{}{"172.16.216.0/21", "172.16.224.0/21"}, tierSubnetCidrs["data"])
+			assert.Equal(t, []interface{}{"172.16.0.0/19", "172.16.32.0/19"}, tierSubnetCidrs["private"])
+
+			// Every tier gets one subnet and one route table per AZ. The map has a key for every tier,
+			// including the disabled intra tier, which has no route tables
+			tierRouteTableIds := terraform.OutputMapOfObjects(t, terraformOptions, "tier_route_table_ids")
+			assert.Equal(t, 5, len(tierRouteTableIds))
+			assert.Equal(t, 0, len(tierRouteTableIds["intra"].([]interface{})))
+			assert.Equal(t, 2, len(tierRouteTableIds["app"].([]interface{})))
+			assert.Equal(t, 2, len(tierRouteTableIds["data"].([]interface{})))
+
+			namedTierSubnetsMap := terraform.OutputMapOfObjects(t, terraformOptions, "named_tier_subnets_map")
+			assert.Equal(t, 2, len(namedTierSubnetsMap["app"].(map[string]interface{})["app"].([]interface{})))
+			assert.Equal(t, 2, len(namedTierSubnetsMap["data"].(map[string]interface{})["data"].([]interface{})))
+
+			// max_nats = 1, shared by the private and app tiers
+			natGatewayIds := terraform.OutputList(t, terraformOptions, "nat_gateway_ids")
+			assert.Equal(t, 1, len(natGatewayIds))
+		},
+	},
+}
+
+// TestExamplesSubnetTiers tests the subnet tiers alongside the built-in public and private subnets
+func TestExamplesSubnetTiers(t *testing.T) {
+	for _, example := range subnetTierExamples {
+		t.Run(example.name, func(t *testing.T) {
+			if example.parallel {
+				t.Parallel()
+			}
+			randID := strings.ToLower(random.UniqueId())
+			attributes := []string{randID}
+
+			rootFolder := "../../"
+			varFiles := []string{"fixtures.us-east-2.tfvars"}
+
+			tempTestFolder := testStructure.CopyTerraformFolderToTemp(t, rootFolder, example.folder)
+
+			terraformOptions := &terraform.Options{
+				// The path to where our Terraform code is located
+				TerraformDir: tempTestFolder,
+				Upgrade:      true,
+				// Variables to pass to our Terraform code using -var-file options
+				VarFiles: varFiles,
+				Vars: map[string]interface{}{
+					"attributes": attributes,
+				},
+			}
+
+			// At the end of the test, run `terraform destroy` to clean up any resources that were created
+			defer cleanup(t, terraformOptions, tempTestFolder)
+
+			// If Go runtime panics, run `terraform destroy` to clean up any resources that were created
+			defer func() {
+				if r := recover(); r != nil {
+					cleanup(t, terraformOptions, tempTestFolder)
+					panic(r) // Re-panic after cleanup
+				}
+			}()
+
+			// This will run `terraform init` and `terraform apply` and fail the test if there are any errors
+			terraform.InitAndApply(t, terraformOptions)
+
+			// Every example keeps the private and public subnets where they would be without the other tiers
+			privateSubnetCidrs := terraform.OutputList(t, terraformOptions, "private_subnet_cidrs")
+			assert.Equal(t, []string{"172.16.0.0/19", "172.16.32.0/19"}, privateSubnetCidrs)
+
+			publicSubnetCidrs := terraform.OutputList(t, terraformOptions, "public_subnet_cidrs")
+			assert.Equal(t, []string{"172.16.96.0/19", "172.16.128.0/19"}, publicSubnetCidrs)
+
+			example.verify(t, terraformOptions)
+		})
+	}
+}
+
+func TestExamplesSubnetTiersDisabled(t *testing.T) {
+	for _, example := range subnetTierExamples {
+		t.Run(example.name, func(t *testing.T) {
+			t.Parallel()
+			randID := strings.ToLower(random.UniqueId())
+			attributes := []string{randID}
+
+			rootFolder := "../../"
+			varFiles := []string{"fixtures.us-east-2.tfvars"}
+
+			tempTestFolder := testStructure.CopyTerraformFolderToTemp(t, rootFolder, example.folder)
+
+			terraformOptions := &terraform.Options{
+				// The path to where our Terraform code is located
+				TerraformDir: tempTestFolder,
+				Upgrade:      true,
+				// Variables to pass to our Terraform code using -var-file options
+				VarFiles: varFiles,
+				Vars: map[string]interface{}{
+					"attributes": attributes,
+					"enabled":    false,
+				},
+			}
+
+			// At the end of the test, run `terraform destroy` to clean up any resources that were created
+			defer cleanup(t, terraformOptions, tempTestFolder)
+
+			// This will run `terraform init` and `terraform apply` and fail the test if there are any errors
+			results := terraform.InitAndApply(t, terraformOptions)
+
+			// Should complete successfully without creating or changing any resources.
+			// Extract the "Resources:" section of the output to make the error message more readable.
+			re := regexp.MustCompile(`Resources: [^.]+\.`)
+			match := re.FindString(results)
+			assert.Equal(t, "Resources: 0 added, 0 changed, 0 destroyed.", match, "Applying with enabled=false should not create any resources")
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	testStructure "github.com/gruntwork-io/terratest/modules/test-structure"
+)
+
+// TestMockedProvider runs the native Terraform tests in the `tests` folder of the module.
+// Those tests use a mocked AWS provider, so they create no resources and need no AWS credentials.
+// NOTE: Mocked providers require Terraform 1.7 or later
+func TestMockedProvider(t *testing.T) {
+	t.Parallel()
+
+	rootFolder := "../../"
+	tempTestFolder := testStructure.CopyTerraformFolderToTemp(t, rootFolder, ".")
+
+	terraformOptions := &terraform.Options{
+		// The path to where our Terraform code is located
+		TerraformDir: tempTestFolder,
+		Upgrade:      true,
+	}
+
+	terraform.Init(t, terraformOptions)
+
+	// `terraform test` exits non-zero, failing the test, if any assertion fails
+	terraform.RunTerraformCommand(t, terraformOptions, "test")
+}
@@ -0,0 +1,167 @@
+# Tests for the routes configured via `additional_routes`.
+# These use a mocked AWS provider, so they need no AWS credentials: run them with `terraform test`.
+
+mock_provider "aws" {
+  mock_data "aws_availability_zones" {
+    defaults = {
+      names    = ["us-east-2a", "us-east-2b", "us-east-2c"]
+      zone_ids = ["use2-az1", "use2-az2", "use2-az3"]
+    }
+  }
+}
+
+variables {
+  vpc_id                       = "vpc-0123456789abcdef0"
+  igw_id                       = ["igw-0123456789abcdef0"]
+  availability_zones           = ["us-east-2a", "us-east-2b"]
+  ipv4_cidr_block              = ["10.0.0.0/16"]
+  nat_gateway_enabled          = false
+  private_subnets_per_az_count = 2
+  private_subnets_per_az_names = ["app", "db"]
+  additional_routes = {
+    peer = {
+      destination_cidr_block    = "172.16.0.0/16"
+      vpc_peering_connection_id = "pcx-0123456789abcdef0"
+    }
+    vpn = {
+      subnet_names           = ["db"]
+      destination_cidr_block = "192.168.0.0/16"
+      gateway_id             = "vgw-0123456789abcdef0"
+    }
+    appliance = {
+      subnet_tier            = "public"
+      destination_cidr_block = "10.1.0.0/16"
+      network_interface_id   = "eni-0123456789abcdef0"
+    }
+  }
+}
+
+run "routes_go_to_the_tier_or_named_route_tables" {
+  command = plan
+
+  assert {
+    condition = keys(aws_route.additional) == [
+      "appliance/shared",
+      "peer/use2a/app",
+      "peer/use2a/db",
+      "peer/use2b/app",
+      "peer/use2b/db",
+      "vpn/use2a/db",
+      "vpn/use2b/db",
+    ]
+    error_message = "Expected a route per route table of the tier, limited to the named subnets where given."
+  }
+
+  assert {
+    condition = (
+      aws_route.additional["vpn/use2b/db"].gateway_id == "vgw-0123456789abcdef0" &&
+      aws_route.additional["vpn/use2b/db"].destination_cidr_block == "192.168.0.0/16" &&
+      aws_route.additional["appliance/shared"].network_interface_id == "eni-0123456789abcdef0"
+    )
+    error_message = "Expected the routes to use the configured targets."
+  }
+}
+
+run "route_table_ids_are_output_by_route" {
+  assert {
+    condition = toset(output.additional_route_table_ids["vpn"]) == toset([
+      aws_route_table.private["use2a/db"].id,
+      aws_route_table.private["use2b/db"].id,
+    ])
+    error_message = "Expected the route tables of the db subnets."
+  }
+}
+
+run "subnet_names_must_exist" {
+  command = plan
+
+  variables {
+    additional_routes = {
+      vpn = {
+        subnet_names           = ["data"]
+        destination_cidr_block = "192.168.0.0/16"
+        gateway_id             = "vgw-0123456789abcdef0"
+      }
+    }
+  }
+
+  expect_failures = [
+    aws_route.additional,
+  ]
+}
+
+run "subnet_tier_must_exist" {
+  command = plan
+
+  variables {
+    additional_routes = {
+      vpn = {
+        subnet_tier            = "privat"
+        destination_cidr_block = "192.168.0.0/16"
+        gateway_id             = "vgw-0123456789abcdef0"
+      }
+    }
+  }
+
+  expect_failures = [
+    aws_route.additional,
+  ]
+}
+
+run "routes_need_exactly_one_target" {
+  command = plan
+
+  variables {
+    additional_routes = {
+      vpn = {
+        destination_cidr_block = "192.168.0.0/16"
+        gateway_id             = "vgw-0123456789abcdef0"
+        transit_gateway_id     = "tgw-0123456789abcdef0"
+      }
+    }
+  }
+
+  expect_failures = [
+    var.additional_routes,
+  ]
+}
+
+run "prefix_list_routes_go_to_every_private_and_public_route_table" {
+  command = plan
+
+  variables {
+    public_route_table_ids = ["rtb-0123456789abcdef0", "rtb-0fedcba9876543210"]
+    additional_routes = {
+      on-premises = {
+        destination_prefix_list_id = "pl-0123456789abcdef0"
+        transit_gateway_id         = "tgw-0123456789abcdef0"
+      }
+      on-premises-public = {
+        subnet_tier                = "public"
+        destination_prefix_list_id = "pl-0123456789abcdef0"
+        transit_gateway_id         = "tgw-0123456789abcdef0"
+      }
+    }
+  }
+
+  assert {
+    condition = keys(aws_route.additional) == [
+      "on-premises-public/0",
+      "on-premises-public/1",
+      "on-premises/use2a/app",
+      "on-premises/use2a/db",
+      "on-premises/use2b/app",
+      "on-premises/use2b/db",
+    ]
+    error_message = "Expected one prefix list route per private and public route table."
+  }
+
+  assert {
+    condition = (
+      aws_route.additional["on-premises-public/1"].route_table_id == "rtb-0fedcba9876543210" &&
+      aws_route.additional["on-premises-public/1"].destination_prefix_list_id == "pl-0123456789abcdef0" &&
+      aws_route.additional["on-premises/use2b/db"].destination_cidr_block == null
+    )
+    error_message = "Expected the prefix list routes to use the supplied public route tables."
+  }
+}
@@ -0,0 +1,126 @@
+# Tests for sending Internet-bound traffic to a Transit Gateway instead of a NAT device.
+# These use a mocked AWS provider, so they need no AWS credentials: run them with `terraform test`.
+
+mock_provider "aws" {
+  mock_data "aws_availability_zones" {
+    defaults = {
+      names    = ["us-east-2a", "us-east-2b", "us-east-2c"]
+      zone_ids = ["use2-az1", "use2-az2", "use2-az3"]
+    }
+  }
+}
+
+variables {
+  vpc_id                  = "vpc-0123456789abcdef0"
+  igw_id                  = ["igw-0123456789abcdef0"]
+  ipv6_egress_only_igw_id = ["eigw-0123456789abcdef0"]
+  availability_zones      = ["us-east-2a", "us-east-2b"]
+  ipv4_cidr_block         = ["10.0.0.0/16"]
+  subnet_tiers = {
+    app = {
+      egress               = "nat"
+      subnets_per_az_sizes = { app = { newbits = 4 } }
+    }
+  }
+  transit_gateway_id = ["tgw-0123456789abcdef0"]
+  transit_gateway_routes = {
+    private = {
+      ipv4_cidrs = ["0.0.0.0/0", "10.0.0.0/8"]
+    }
+  }
+  centralized_egress = {
+    enabled = true
+  }
+}
+
+run "default_routes_go_to_the_transit_gateway" {
+  command = plan
+
+  assert {
+    condition = keys(aws_route.transit_gateway) == [
+      "app/use2a/app/0.0.0.0/0",
+      "app/use2b/app/0.0.0.0/0",
+      "private/use2a/common/0.0.0.0/0",
+      "private/use2a/common/10.0.0.0/8",
+      "private/use2b/common/0.0.0.0/0",
+      "private/use2b/common/10.0.0.0/8",
+    ]
+    error_message = "Expected a default route to the Transit Gateway for each NAT egress tier, without duplicating the listed one."
+  }
+
+  assert {
+    condition = (
+      length(aws_nat_gateway.default) == 0 && length(aws_eip.default) == 0 && length(aws_instance.nat_instance) == 0 &&
+      length(aws_route.nat4) == 0 && length(aws_route.tier_nat4) == 0
+    )
+    error_message = "Expected no NAT devices, Elastic IPs or NAT routes."
+  }
+}
+
+run "ipv6_uses_the_egress_only_gateway_and_nat64_the_transit_gateway" {
+  command = plan
+
+  variables {
+    ipv6_enabled    = true
+    ipv6_cidr_block = ["2600:1f16:c52:ab00::/56"]
+  }
+
+  assert {
+    condition = (
+      length(aws_route.private6) == 2 && length(aws_route.tier_egress_only6) == 2 &&
+      contains(keys(aws_route.transit_gateway), "private/use2a/common/64:ff9b::/96") &&
+      contains(keys(aws_route.transit_gateway), "app/use2b/app/64:ff9b::/96") &&
+      !contains(keys(aws_route.transit_gateway), "private/use2a/common/::/0")
+    )
+    error_message = "Expected ::/0 via the Egress-only Internet Gateway and NAT64 via the Transit Gateway."
+  }
+
+  assert {
+    condition     = length(aws_nat_gateway.default) == 0 && length(aws_route.private_nat64) == 0 && length(aws_route.tier_nat64) == 0
+    error_message = "Expected no NAT Gateways for NAT64."
+  }
+}
+
+run "ipv6_and_nat64_can_stay_local" {
+  command = plan
+
+  variables {
+    ipv6_enabled    = true
+    ipv6_cidr_block = ["2600:1f16:c52:ab00::/56"]
+    centralized_egress = {
+      enabled      = true
+      ipv6_enabled = true
+      nat64        = "nat_gateway"
+    }
+  }
+
+  assert {
+    condition = (
+      length(aws_route.private6) == 0 && length(aws_route.tier_egress_only6) == 0 &&
+      contains(keys(aws_route.transit_gateway), "private/use2a/common/::/0") &&
+      !contains(keys(aws_route.transit_gateway), "private/use2a/common/64:ff9b::/96")
+    )
+    error_message = "Expected ::/0 via the Transit Gateway and no NAT64 route to it."
+  }
+
+  assert {
+    condition = (
+      length(aws_nat_gateway.default) == 2 && length(aws_route.private_nat64) == 2 && length(aws_route.tier_nat64) == 2 &&
+      length(aws_route.nat4) == 0 && length(aws_route.tier_nat4) == 0
+    )
+    error_message = "Expected NAT Gateways used only for NAT64."
+  }
+}
+
+run "transit_gateway_is_required" {
+  command = plan
+
+  variables {
+    transit_gateway_id     = []
+    transit_gateway_routes = {}
+  }
+
+  expect_failures = [
+    aws_route.transit_gateway,
+  ]
+}
@@ -0,0 +1,177 @@
+# Tests for pinning subnet CIDRs to a fixed grid of cells.
+# These use a mocked AWS provider, so they need no AWS credentials: run them with `terraform test`.
+
+mock_provider "aws" {
+  mock_data "aws_availability_zones" {
+    defaults = {
+      names    = ["us-east-2a", "us-east-2b", "us-east-2c"]
+      zone_ids = ["use2-az1", "use2-az2", "use2-az3"]
+    }
+  }
+}
+
+variables {
+  vpc_id                       = "vpc-0123456789abcdef0"
+  igw_id                       = ["igw-0123456789abcdef0"]
+  availability_zones           = ["us-east-2a", "us-east-2b"]
+  ipv4_cidr_block              = ["10.0.0.0/16"]
+  nat_gateway_enabled          = false
+  private_subnets_per_az_count = 2
+  private_subnets_per_az_names = ["app", "database"]
+  cidr_grid = {
+    enabled = true
+  }
+}
+
+# 4 tiers x 8 AZs x 4 subnets = 128 cells, each a /23 of the /16
+run "subnets_get_the_cell_for_their_tier_az_and_name" {
+  command = plan
+
+  assert {
+    condition     = [for s in aws_subnet.private : s.cidr_block] == ["10.0.0.0/23", "10.0.2.0/23", "10.0.8.0/23", "10.0.10.0/23"]
+    error_message = "Expected the private subnets in the cells of tier 0."
+  }
+
+  assert {
+    condition     = [for s in aws_subnet.public : s.cidr_block] == ["10.0.64.0/23", "10.0.72.0/23"]
+    error_message = "Expected the public subnets in the cells of tier 1."
+  }
+}
+
+run "adding_an_az_and_a_name_does_not_move_existing_subnets" {
+  command = plan
+
+  variables {
+    availability_zones           = ["us-east-2a", "us-east-2b", "us-east-2c"]
+    private_subnets_per_az_count = 3
+    private_subnets_per_az_names = ["app", "database", "cache"]
+    max_subnet_count             = 3
+  }
+
+  assert {
+    condition = { for k, s in aws_subnet.private : k => s.cidr_block } == {
+      "use2a/app"      = "10.0.0.0/23"
+      "use2a/database" = "10.0.2.0/23"
+      "use2a/cache"    = "10.0.4.0/23"
+      "use2b/app"      = "10.0.8.0/23"
+      "use2b/database" = "10.0.10.0/23"
+      "use2b/cache"    = "10.0.12.0/23"
+      "use2c/app"      = "10.0.16.0/23"
+      "use2c/database" = "10.0.18.0/23"
+      "use2c/cache"    = "10.0.20.0/23"
+    }
+    error_message = "Expected the existing app and database subnets to keep their keys and CIDRs."
+  }
+
+  assert {
+    condition     = [for k in ["use2a/common", "use2b/common", "use2c/common"] : aws_subnet.public[k].cidr_block] == ["10.0.64.0/23", "10.0.72.0/23", "10.0.80.0/23"]
+    error_message = "Expected the existing public subnets to keep their CIDRs."
+  }
+}
+
+run "sizes_shrink_subnets_within_their_cell" {
+  command = plan
+
+  variables {
+    private_subnets_per_az_sizes = {
+      database = {
+        host_count = 20
+      }
+    }
+  }
+
+  assert {
+    condition     = [for s in aws_subnet.private : s.cidr_block] == ["10.0.0.0/23", "10.0.2.0/27", "10.0.8.0/23", "10.0.10.0/27"]
+    error_message = "Expected the database subnets at the start of their cells."
+  }
+}
+
+run "grid_too_small_for_the_subnets" {
+  command = plan
+
+  variables {
+    cidr_grid = {
+      enabled      = true
+      subnet_slots = 1
+    }
+  }
+
+  # The check applies to every subnet
+  expect_failures = [
+    terraform_data.subnet_cidrs,
+  ]
+}
+
+run "additional_tiers_get_the_cells_of_their_grid_slot" {
+  command = plan
+
+  variables {
+    cidr_grid = {
+      enabled    = true
+      tier_slots = 8
+    }
+    subnet_tiers = {
+      data = { egress = "none", grid_slot = 3 }
+    }
+  }
+
+  # 8 tiers x 8 AZs x 4 subnets = 256 cells, each a /24 of the /16
+  assert {
+    condition     = [for s in aws_subnet.tier : s.cidr_block] == ["10.0.96.0/24", "10.0.100.0/24"]
+    error_message = "Expected the data subnets in the cells of slot 3."
+  }
+}
+
+run "adding_a_tier_does_not_move_the_other_tiers" {
+  command = plan
+
+  variables {
+    cidr_grid = {
+      enabled    = true
+      tier_slots = 8
+    }
+    subnet_tiers = {
+      cache = { egress = "none", grid_slot = 4 }
+      data  = { egress = "none", grid_slot = 3 }
+    }
+  }
+
+  assert {
+    condition     = aws_subnet.tier["data/use2a/data"].cidr_block == "10.0.96.0/24" && aws_subnet.tier["data/use2b/data"].cidr_block == "10.0.100.0/24"
+    error_message = "Expected the data subnets to keep their CIDRs when a tier that sorts before them is added."
+  }
+
+  assert {
+    condition     = aws_subnet.tier["cache/use2a/cache"].cidr_block == "10.0.128.0/24" && aws_subnet.private["use2a/app"].cidr_block == "10.0.0.0/24"
+    error_message = "Expected the cache subnets in the cells of slot 4, and the private subnets to stay in slot 0."
+  }
+}
+
+run "additional_tiers_need_a_grid_slot" {
+  command = plan
+
+  variables {
+    subnet_tiers = {
+      data = { egress = "none" }
+    }
+  }
+
+  expect_failures = [
+    terraform_data.subnet_cidrs,
+  ]
+}
+
+run "grid_slots_must_be_unique" {
+  command = plan
+
+  variables {
+    subnet_tiers = {
+      cache = { egress = "none", grid_slot = 3 }
+      data  = { egress = "none", grid_slot = 3 }
+    }
+  }
+
+  expect_failures = [
+    var.subnet_tiers,
+  ]
+}
@@ -0,0 +1,123 @@
+# Tests for keying subnets, route tables and NAT devices by Availability Zone and subnet name.
+# These use a mocked AWS provider, so they need no AWS credentials: run them with `terraform test`.
+
+mock_provider "aws" {
+  mock_data "aws_availability_zones" {
+    defaults = {
+      names    = ["us-east-2a", "us-east-2b", "us-east-2c"]
+      zone_ids = ["use2-az1", "use2-az2", "use2-az3"]
+    }
+  }
+}
+
+variables {
+  vpc_id                       = "vpc-0123456789abcdef0"
+  igw_id                       = ["igw-0123456789abcdef0"]
+  availability_zones           = ["us-east-2a", "us-east-2b", "us-east-2c"]
+  ipv4_cidr_block              = ["10.0.0.0/16"]
+  private_subnets_per_az_count = 2
+  private_subnets_per_az_names = ["app", "database"]
+  cidr_grid = {
+    enabled = true
+  }
+}
+
+run "resources_are_keyed_by_az_and_name" {
+  command = plan
+
+  assert {
+    condition = keys(aws_subnet.private) == [
+      "use2a/app", "use2a/database", "use2b/app", "use2b/database", "use2c/app", "use2c/database",
+    ]
+    error_message = "Expected the private subnets to be keyed by short AZ code and subnet name."
+  }
+
+  assert {
+    condition     = keys(aws_route_table.private) == keys(aws_subnet.private) && keys(aws_route.nat4) == keys(aws_subnet.private)
+    error_message = "Expected each private route table and its NAT route to have the key of its subnet."
+  }
+
+  assert {
+    condition     = keys(aws_nat_gateway.default) == ["use2a/common", "use2b/common", "use2c/common"] && keys(aws_eip.default) == keys(aws_nat_gateway.default)
+    error_message = "Expected each NAT Gateway and its EIP to have the key of the public subnet it is in."
+  }
+
+  assert {
+    condition     = keys(aws_route_table.public) == ["shared"]
+    error_message = "Expected the single public route table to be keyed `shared`."
+  }
+}
+
+run "removing_the_middle_az_leaves_the_others_alone" {
+  variables {
+    availability_zones = ["us-east-2a", "us-east-2c"]
+  }
+
+  assert {
+    condition = { for k, s in aws_subnet.private : k => s.cidr_block } == {
+      "use2a/app"      = "10.0.0.0/23"
+      "use2a/database" = "10.0.2.0/23"
+      "use2c/app"      = "10.0.16.0/23"
+      "use2c/database" = "10.0.18.0/23"
+    }
+    error_message = "Expected the subnets of us-east-2c to keep their keys and CIDRs."
+  }
+
+  assert {
+    condition     = aws_nat_gateway.default["use2c/common"].subnet_id == aws_subnet.public["use2c/common"].id && aws_route.nat4["use2c/database"].nat_gateway_id == aws_nat_gateway.default["use2c/common"].id
+    error_message = "Expected the private subnets of us-east-2c to keep routing to the NAT Gateway in us-east-2c."
+  }
+}
+
+run "appending_a_subnet_name_leaves_the_others_alone" {
+  command = plan
+
+  variables {
+    private_subnets_per_az_count = 3
+    private_subnets_per_az_names = ["app", "database", "cache"]
+  }
+
+  assert {
+    condition = [for k in ["use2a/app", "use2a/database", "use2a/cache", "use2b/app", "use2b/database"] : aws_subnet.private[k].cidr_block] == [
+      "10.0.0.0/23", "10.0.2.0/23", "10.0.4.0/23", "10.0.8.0/23", "10.0.10.0/23",
+    ]
+    error_message = "Expected the new subnets in cells of their own, and the subnets of the later AZs to keep their keys and CIDRs."
+  }
+}
+
+run "unnamed_positions_are_keyed_by_index" {
+  command = plan
+
+  variables {
+    private_subnets_per_az_count = 3
+    cidr_grid = {
+      enabled = false
+    }
+  }
+
+  assert {
+    condition     = [for k in keys(aws_subnet.private) : k if startswith(k, "use2a/")] == ["use2a/2", "use2a/app", "use2a/database"]
+    error_message = "Expected the subnet without a name to be keyed by its position."
+  }
+}
+
+run "state_moves_map_count_addresses_to_keys" {
+  command = plan
+
+  assert {
+    condition = [
+      for a in ["aws_subnet.private[1]", "aws_route.nat4[2]", "aws_nat_gateway.default[2]", "aws_route_table.public[0]"] : output.count_to_for_each_state_moves[a]
+      ] == [
+      "aws_subnet.private[\"use2a/database\"]",
+      "aws_route.nat4[\"use2b/app\"]",
+      "aws_nat_gateway.default[\"use2c/common\"]",
+      "aws_route_table.public[\"shared\"]",
+    ]
+    error_message = "Expected the moves to follow the order in which `count` created the resources."
+  }
+
+  assert {
+    condition     = !contains(keys(output.count_to_for_each_state_moves), "aws_instance.nat_instance[0]")
+    error_message = "Expected no moves for resources that are not created."
+  }
+}
@@ -0,0 +1,159 @@
+# Tests for allocating subnet CIDRs from IPAM pools.
+# These use a mocked AWS provider, so they need no AWS credentials: run them with `terraform test`.
+
+mock_provider "aws" {
+  mock_data "aws_availability_zones" {
+    defaults = {
+      names    = ["us-east-2a", "us-east-2b", "us-east-2c"]
+      zone_ids = ["use2-az1", "use2-az2", "use2-az3"]
+    }
+  }
+}
+
+variables {
+  vpc_id              = "vpc-0123456789abcdef0"
+  igw_id              = ["igw-0123456789abcdef0"]
+  availability_zones  = ["us-east-2a", "us-east-2b"]
+  nat_gateway_enabled = false
+  ipv4_ipam_pool_id   = ["ipam-pool-0123456789abcdef0"]
+}
+
+run "ipv4_cidrs_are_allocated_from_the_pool" {
+  override_resource {
+    target = aws_vpc_ipam_pool_cidr_allocation.ipv4
+    values = {
+      cidr = "10.0.8.0/24"
+    }
+  }
+
+  assert {
+    condition     = length(aws_vpc_ipam_pool_cidr_allocation.ipv4) == 4
+    error_message = "Expected one IPv4 allocation for each of the 2 private and 2 public subnets."
+  }
+
+  assert {
+    condition = alltrue([
+      for a in aws_vpc_ipam_pool_cidr_allocation.ipv4 : a.ipam_pool_id == "ipam-pool-0123456789abcdef0" && a.netmask_length == 24
+    ])
+    error_message = "Expected every allocation to come from the pool with the default netmask length."
+  }
+
+  assert {
+    condition     = alltrue([for s in concat(values(aws_subnet.private), values(aws_subnet.public)) : s.cidr_block == "10.0.8.0/24"])
+    error_message = "Expected every subnet to use the CIDR allocated from the pool."
+  }
+
+  assert {
+    condition     = length(data.aws_vpc.default) == 0
+    error_message = "The VPC CIDR is not needed when allocating from a pool."
+  }
+}
+
+run "host_count_sizes_set_the_netmask_length" {
+  command = plan
+
+  variables {
+    ipv4_ipam_netmask_length     = 26
+    private_subnets_per_az_names = ["app", "database"]
+    private_subnets_per_az_count = 2
+    private_subnets_per_az_sizes = {
+      app = {
+        host_count = 1000
+      }
+    }
+  }
+
+  assert {
+    condition = [for k in ["private/use2a/app", "private/use2a/database", "private/use2b/app", "private/use2b/database", "public/use2a/common"] : aws_vpc_ipam_pool_cidr_allocation.ipv4[k].netmask_length] == [
+      22, 26, 22, 26, 26
+    ]
+    error_message = "Expected a /22 for the 1000-host app subnets and the default netmask length for all others."
+  }
+}
+
+run "small_host_count_sizes_get_a_slash_28" {
+  command = plan
+
+  variables {
+    private_subnets_per_az_sizes = {
+      common = {
+        host_count = 2
+      }
+    }
+  }
+
+  assert {
+    condition     = aws_vpc_ipam_pool_cidr_allocation.ipv4["private/use2a/common"].netmask_length == 28
+    error_message = "Expected a /28, the smallest subnet AWS allows, for a 2-host subnet."
+  }
+}
+
+run "newbits_sizes_are_rejected" {
+  command = plan
+
+  variables {
+    private_subnets_per_az_names = ["app", "database"]
+    private_subnets_per_az_count = 2
+    private_subnets_per_az_sizes = {
+      app = {
+        newbits = 2
+      }
+    }
+  }
+
+  expect_failures = [
+    aws_vpc_ipam_pool_cidr_allocation.ipv4,
+  ]
+}
+
+run "ipv6_cidrs_are_allocated_from_the_pool" {
+  variables {
+    ipv4_enabled      = false
+    ipv6_enabled      = true
+    ipv4_ipam_pool_id = []
+    ipv6_ipam_pool_id = ["ipam-pool-0fedcba9876543210"]
+  }
+
+  override_resource {
+    target = aws_vpc_ipam_pool_cidr_allocation.ipv6
+    values = {
+      cidr = "2600:1f16:c52:ab01::/64"
+    }
+  }
+
+  assert {
+    condition     = length(aws_vpc_ipam_pool_cidr_allocation.ipv6) == 4 && length(aws_vpc_ipam_pool_cidr_allocation.ipv4) == 0
+    error_message = "Expected one IPv6 allocation for each subnet and no IPv4 allocations."
+  }
+
+  assert {
+    condition     = alltrue([for a in aws_vpc_ipam_pool_cidr_allocation.ipv6 : a.netmask_length == 64])
+    error_message = "Expected every IPv6 allocation to be a /64."
+  }
+
+  assert {
+    condition     = alltrue([for s in aws_subnet.private : s.ipv6_cidr_block == "2600:1f16:c52:ab01::/64" && s.ipv6_native])
+    error_message = "Expected every private subnet to be IPv6-native with the CIDR allocated from the pool."
+  }
+}
+
+run "supplied_cidrs_take_precedence_over_the_pool" {
+  command = plan
+
+  variables {
+    ipv4_cidrs = [{
+      private = ["10.0.0.0/24", "10.0.1.0/24"]
+      public  = ["10.0.2.0/24", "10.0.3.0/24"]
+    }]
+  }
+
+  assert {
+    condition     = length(aws_vpc_ipam_pool_cidr_allocation.ipv4) == 0
+    error_message = "No allocations should be made when CIDRs are supplied."
+  }
+
+  assert {
+    condition     = aws_subnet.private["use2b/common"].cidr_block == "10.0.1.0/24"
+    error_message = "Expected the supplied CIDRs to be used."
+  }
+}
@@ -0,0 +1,121 @@
+# Tests for the secondary Elastic IPs and private IPs of NAT Gateways, which mitigate port exhaustion.
+# These use a mocked AWS provider, so they need no AWS credentials: run them with `terraform test`.
+
+mock_provider "aws" {
+  mock_data "aws_availability_zones" {
+    defaults = {
+      names    = ["us-east-2a", "us-east-2b", "us-east-2c"]
+      zone_ids = ["use2-az1", "use2-az2", "use2-az3"]
+    }
+  }
+}
+
+variables {
+  vpc_id                          = "vpc-0123456789abcdef0"
+  igw_id                          = ["igw-0123456789abcdef0"]
+  availability_zones              = ["us-east-2a", "us-east-2b"]
+  ipv4_cidr_block                 = ["10.0.0.0/16"]
+  nat_gateway_secondary_eip_count = 2
+}
+
+run "secondary_eips_are_created_per_nat_gateway" {
+  assert {
+    condition = keys(aws_eip.default) == [
+      "use2a/common",
+      "use2a/common/1",
+      "use2a/common/2",
+      "use2b/common",
+      "use2b/common/1",
+      "use2b/common/2",
+    ]
+    error_message = "Expected a primary and two secondary Elastic IPs for each NAT Gateway."
+  }
+
+  assert {
+    condition = (
+      aws_nat_gateway.default["use2b/common"].allocation_id == aws_eip.default["use2b/common"].id &&
+      aws_nat_gateway.default["use2b/common"].secondary_allocation_ids == toset([aws_eip.default["use2b/common/1"].id, aws_eip.default["use2b/common/2"].id])
+    )
+    error_message = "Expected each NAT Gateway to use its own secondary Elastic IPs."
+  }
+}
+
+run "outputs_are_grouped_per_nat_gateway" {
+  assert {
+    condition = (
+      output.nat_ips == [aws_eip.default["use2a/common"].public_ip, aws_eip.default["use2b/common"].public_ip] &&
+      output.nat_eip_allocation_ids == [aws_eip.default["use2a/common"].id, aws_eip.default["use2b/common"].id] &&
+      [for id in output.nat_gateway_eip_allocation_ids_map["use2a/common"] : id] == [
+        aws_eip.default["use2a/common"].id, aws_eip.default["use2a/common/1"].id, aws_eip.default["use2a/common/2"].id,
+      ] &&
+      output.nat_gateway_ips_map["use2b/common"][2] == aws_eip.default["use2b/common/2"].public_ip
+    )
+    error_message = "Expected the Elastic IPs of each NAT Gateway, primary first."
+  }
+}
+
+run "output_keys_are_known_at_plan_time" {
+  command = plan
+
+  assert {
+    condition = (
+      keys(output.nat_gateway_ips_map) == ["use2a/common", "use2b/common"] &&
+      keys(output.nat_gateway_eip_allocation_ids_map) == ["use2a/common", "use2b/common"]
+    )
+    error_message = "Expected the NAT Gateway Elastic IPs to be keyed by NAT key at plan time."
+  }
+}
+
+run "supplied_eips_are_grouped_after_the_primaries" {
+  variables {
+    nat_gateway_secondary_eip_count = 1
+    nat_elastic_ips                 = ["192.0.2.1", "192.0.2.2", "192.0.2.11", "192.0.2.21"]
+  }
+
+  assert {
+    condition     = length(aws_eip.default) == 0 && length(data.aws_eip.nat) == 4
+    error_message = "Expected the supplied Elastic IPs to be looked up instead of created."
+  }
+
+  assert {
+    condition = (
+      aws_nat_gateway.default["use2b/common"].allocation_id == data.aws_eip.nat[1].id &&
+      aws_nat_gateway.default["use2b/common"].secondary_allocation_ids == toset([data.aws_eip.nat[3].id])
+    )
+    error_message = "Expected the second NAT Gateway to use the second and fourth Elastic IPs."
+  }
+
+  assert {
+    condition     = output.nat_ips == ["192.0.2.1", "192.0.2.2"] && output.nat_gateway_ips_map["use2b/common"] == ["192.0.2.2", "192.0.2.21"]
+    error_message = "Expected only the primary Elastic IPs in `nat_ips`, and every Elastic IP in `nat_gateway_ips_map`."
+  }
+}
+
+run "supplied_eips_must_cover_the_secondary_eips" {
+  command = plan
+
+  variables {
+    nat_elastic_ips = ["192.0.2.1", "192.0.2.2", "192.0.2.11"]
+  }
+
+  expect_failures = [
+    aws_nat_gateway.default,
+  ]
+}
+
+run "private_nat_gateways_get_secondary_private_ips" {
+  command = plan
+
+  variables {
+    nat_gateway_secondary_eip_count = 0
+    private_nat_gateway = {
+      enabled                            = true
+      secondary_private_ip_address_count = 3
+    }
+  }
+
+  assert {
+    condition     = aws_nat_gateway.private["use2a/common"].secondary_private_ip_address_count == 3
+    error_message = "Expected the private NAT Gateways to get the secondary private IPs."
+  }
+}
@@ -0,0 +1,533 @@
+# Tests for the NAT instances.
+# These use a mocked AWS provider, so they need no AWS credentials: run them with `terraform test`.
+
+mock_provider "aws" {
+  mock_data "aws_availability_zones" {
+    defaults = {
+      names    = ["us-east-2a", "us-east-2b", "us-east-2c"]
+      zone_ids = ["use2-az1", "use2-az2", "use2-az3"]
+    }
+  }
+
+  mock_data "aws_ami" {
+    defaults = {
+      id = "ami-0123456789abcdef0"
+    }
+  }
+
+  mock_data "aws_iam_policy_document" {
+    defaults = {
+      json = "{\"Version\":\"2012-10-17\",\"Statement\":[]}"
+    }
+  }
+
+  mock_data "aws_partition" {
+    defaults = {
+      partition = "aws"
+    }
+  }
+
+  mock_resource "aws_launch_template" {
+    defaults = {
+      id = "lt-0123456789abcdef0"
+    }
+  }
+
+  mock_resource "aws_iam_instance_profile" {
+    defaults = {
+      arn = "arn:aws:iam::123456789012:instance-profile/eg-test-nat-instance"
+    }
+  }
+}
+
+variables {
+  vpc_id               = "vpc-0123456789abcdef0"
+  igw_id               = ["igw-0123456789abcdef0"]
+  availability_zones   = ["us-east-2a", "us-east-2b"]
+  ipv4_cidr_block      = ["10.0.0.0/16"]
+  nat_instance_enabled = true
+}
+
+run "amazon_linux_2023_is_configured_to_nat" {
+  command = plan
+
+  assert {
+    condition     = data.aws_ami.nat_instance[0].owners == tolist(["amazon"]) && output.nat_instance_ami_id == "ami-0123456789abcdef0"
+    error_message = "Expected the latest Amazon Linux 2023 AMI."
+  }
+
+  assert {
+    condition     = alltrue([for i in aws_instance.nat_instance : strcontains(i.user_data, "MASQUERADE") && !i.source_dest_check])
+    error_message = "Expected user data that sets up masquerading."
+  }
+}
+
+run "fck_nat_configures_itself" {
+  command = plan
+
+  variables {
+    nat_instance_ami_family = "fck-nat"
+  }
+
+  assert {
+    condition     = data.aws_ami.nat_instance[0].owners == tolist(["568608671756"])
+    error_message = "Expected the fck-nat AMI."
+  }
+
+  assert {
+    condition     = alltrue([for i in aws_instance.nat_instance : i.user_data == null])
+    error_message = "Expected no user data for the fck-nat AMI."
+  }
+}
+
+run "supplied_ami_is_used" {
+  command = plan
+
+  variables {
+    nat_instance_ami_id = ["ami-0fedcba9876543210"]
+  }
+
+  assert {
+    condition     = length(data.aws_ami.nat_instance) == 0 && aws_instance.nat_instance["use2a/common"].ami == "ami-0fedcba9876543210"
+    error_message = "Expected the supplied AMI to be used without a lookup."
+  }
+}
+
+run "auto_scaling_groups_replace_the_instances" {
+  variables {
+    nat_instance_auto_scaling_group_enabled = true
+  }
+
+  assert {
+    condition = (
+      length(aws_instance.nat_instance) == 0 && length(aws_eip_association.nat_instance) == 0 && length(aws_route.nat_instance) == 0 &&
+      keys(aws_autoscaling_group.nat_instance) == ["use2a/common", "use2b/common"] &&
+      aws_autoscaling_group.nat_instance["use2b/common"].max_size == 1 &&
+      aws_autoscaling_group.nat_instance["use2b/common"].vpc_zone_identifier == toset([aws_subnet.public["use2b/common"].id])
+    )
+    error_message = "Expected an Auto Scaling group of one NAT instance in each public subnet, and no standalone instances."
+  }
+
+  assert {
+    condition = (
+      strcontains(base64decode(aws_launch_template.nat_instance["use2b/common"].user_data), "associate-address") &&
+      strcontains(base64decode(aws_launch_template.nat_instance["use2b/common"].user_data), "MASQUERADE") &&
+      length(aws_iam_instance_profile.nat_instance) == 1
+    )
+    error_message = "Expected the NAT instances to take over the Elastic IP and routes on boot, with an instance profile to do so."
+  }
+
+  assert {
+    condition     = strcontains(base64decode(aws_launch_template.nat_instance["use2b/common"].user_data), "set-instance-health")
+    error_message = "Expected a NAT instance that cannot take over to mark itself unhealthy."
+  }
+
+  assert {
+    condition = (
+      [for s in data.aws_iam_policy_document.nat_instance[0].statement : s.sid] == ["TakeOverElasticIps", "TakeOverInstances", "ReportUnhealthy", "Routes"] &&
+      alltrue([for s in data.aws_iam_policy_document.nat_instance[0].statement : !contains(s.resources, "*")]) &&
+      length(data.aws_iam_policy_document.nat_instance[0].statement[0].resources) == 2 &&
+      tolist(one(data.aws_iam_policy_document.nat_instance[0].statement[1].condition).values) == tolist([
+        aws_launch_template.nat_instance["use2a/common"].name, aws_launch_template.nat_instance["use2b/common"].name,
+      ])
+    )
+    error_message = "Expected the instance role to be limited to the Elastic IPs, instances, Auto Scaling groups and route tables of the NAT instances."
+  }
+}
+
+run "auto_scaling_groups_need_the_instance_metadata_service" {
+  command = plan
+
+  variables {
+    nat_instance_auto_scaling_group_enabled = true
+    metadata_http_endpoint_enabled          = false
+  }
+
+  expect_failures = [
+    aws_autoscaling_group.nat_instance,
+  ]
+}
+
+run "nat_instances_can_perform_nat64" {
+  variables {
+    ipv6_enabled               = true
+    ipv6_cidr_block            = ["2600:1f16:c52:ab00::/56"]
+    nat_instance_nat64_enabled = true
+    nat_instance_nat64_tayga_source = {
+      url    = "https://example.com/tayga-release.tar.gz"
+      sha256 = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+    }
+  }
+
+  assert {
+    condition = (
+      length(aws_route.nat_instance_nat64) == 2 &&
+      alltrue([for r in aws_route.nat_instance_nat64 : r.destination_ipv6_cidr_block == "64:ff9b::/96"]) &&
+      aws_route.nat_instance_nat64["use2b/common"].network_interface_id == aws_instance.nat_instance["use2b/common"].primary_network_interface_id
+    )
+    error_message = "Expected the NAT64 prefix of each private route table routed to the NAT instance in its AZ."
+  }
+
+  assert {
+    condition = (
+      aws_instance.nat_instance["use2a/common"].ipv6_address_count == 1 &&
+      strcontains(aws_instance.nat_instance["use2a/common"].user_data, "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef  /usr/local/src/tayga.tar") &&
+      toset(aws_security_group_rule.nat_instance_ingress6[0].ipv6_cidr_blocks) == toset([for s in aws_subnet.private : s.ipv6_cidr_block])
+    )
+    error_message = "Expected the NAT instances to get an IPv6 address, run the checked TAYGA release and accept IPv6 traffic from the private subnets."
+  }
+}
+
+run "nat64_on_nat_instances_needs_a_tayga_source" {
+  command = plan
+
+  variables {
+    ipv6_enabled               = true
+    ipv6_cidr_block            = ["2600:1f16:c52:ab00::/56"]
+    nat_instance_nat64_enabled = true
+  }
+
+  expect_failures = [
+    aws_security_group.nat_instance,
+  ]
+}
+
+run "nat64_is_not_routed_to_nat_instances_by_default" {
+  command = plan
+
+  variables {
+    ipv6_enabled    = true
+    ipv6_cidr_block = ["2600:1f16:c52:ab00::/56"]
+  }
+
+  assert {
+    condition     = length(aws_route.nat_instance_nat64) == 0 && !strcontains(aws_instance.nat_instance["use2a/common"].user_data, "tayga")
+    error_message = "Expected no NAT64 on the NAT instances unless enabled."
+  }
+}
+
+run "nat64_on_nat_instances_needs_amazon_linux_2023" {
+  command = plan
+
+  variables {
+    ipv6_enabled               = true
+    ipv6_cidr_block            = ["2600:1f16:c52:ab00::/56"]
+    nat_instance_nat64_enabled = true
+    nat_instance_ami_family    = "fck-nat"
+    nat_instance_nat64_tayga_source = {
+      url    = "https://example.com/tayga-release.tar.gz"
+      sha256 = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+    }
+  }
+
+  expect_failures = [
+    aws_security_group.nat_instance,
+  ]
+}
+
+run "instance_profile_allows_session_manager" {
+  command = plan
+
+  variables {
+    nat_instance_iam_instance_profile = {
+      enabled                  = true
+      cloudwatch_agent_enabled = false
+    }
+  }
+
+  assert {
+    condition = (
+      keys(aws_iam_role_policy_attachment.nat_instance) == ["AmazonSSMManagedInstanceCore"] &&
+      aws_instance.nat_instance["use2a/common"].iam_instance_profile == module.nat_instance_label.id &&
+      length(aws_iam_role_policy.nat_instance) == 0
+    )
+    error_message = "Expected an instance profile with only the Session Manager policy attached."
+  }
+}
+
+run "existing_instance_profile_is_used" {
+  command = plan
+
+  variables {
+    nat_instance_iam_instance_profile = {
+      name = "nat-debugging"
+    }
+  }
+
+  assert {
+    condition     = length(aws_iam_role.nat_instance) == 0 && aws_instance.nat_instance["use2b/common"].iam_instance_profile == "nat-debugging"
+    error_message = "Expected the existing instance profile, and no role created."
+  }
+}
+
+run "metrics_are_published" {
+  command = plan
+
+  variables {
+    nat_instance_metrics_enabled = true
+  }
+
+  assert {
+    condition = (
+      strcontains(aws_instance.nat_instance["use2a/common"].user_data, "nf_conntrack_count") &&
+      length(aws_iam_role_policy.nat_instance) == 1 && length(aws_iam_role_policy_attachment.nat_instance) == 0 &&
+      aws_instance.nat_instance["use2a/common"].iam_instance_profile == module.nat_instance_label.id
+    )
+    error_message = "Expected the NAT instances to publish metrics with a role that allows it."
+  }
+}
+
+run "metrics_need_systemd" {
+  command = plan
+
+  variables {
+    nat_instance_metrics_enabled = true
+    nat_instance_ami_family      = "amzn-ami-vpc-nat"
+  }
+
+  expect_failures = [
+    aws_security_group.nat_instance,
+  ]
+}
+
+run "ingress_defaults_to_the_subnets_that_use_the_nat_instances" {
+  command = plan
+
+  variables {
+    ipv4_cidr_block = []
+    ipv4_cidrs = [{
+      private = ["10.0.0.0/24", "172.16.0.0/24"]
+      public  = ["10.0.100.0/24", "10.0.101.0/24"]
+    }]
+  }
+
+  assert {
+    condition = (
+      toset(aws_security_group_rule.nat_instance_ingress[0].cidr_blocks) == toset(["10.0.0.0/24", "172.16.0.0/24"]) &&
+      aws_security_group_rule.nat_instance_egress[0].cidr_blocks == tolist(["0.0.0.0/0"]) &&
+      length(aws_security_group_rule.nat_instance_additional_egress) == 0
+    )
+    error_message = "Expected ingress from the supplied private subnet CIDRs, and all egress allowed."
+  }
+}
+
+run "security_group_rules_are_configurable" {
+  command = plan
+
+  variables {
+    nat_instance_security_group = {
+      allowed_ipv4_cidrs            = ["192.168.0.0/16"]
+      allowed_prefix_list_ids       = ["pl-0123456789abcdef0"]
+      additional_security_group_ids = ["sg-0123456789abcdef0"]
+      egress_rules = [
+        { protocol = "tcp", from_port = 443, to_port = 443, cidr_blocks = ["0.0.0.0/0"] },
+        { protocol = "udp", from_port = 123, to_port = 123, prefix_list_ids = ["pl-0fedcba9876543210"] },
+      ]
+    }
+  }
+
+  assert {
+    condition = (
+      contains(aws_security_group_rule.nat_instance_ingress[0].cidr_blocks, "192.168.0.0/16") &&
+      aws_security_group_rule.nat_instance_ingress_prefix_lists[0].prefix_list_ids == tolist(["pl-0123456789abcdef0"]) &&
+      contains(aws_instance.nat_instance["use2a/common"].vpc_security_group_ids, "sg-0123456789abcdef0")
+    )
+    error_message = "Expected the additional CIDRs, prefix lists and security groups."
+  }
+
+  assert {
+    condition = (
+      aws_security_group_rule.nat_instance_egress[0].from_port == 443 &&
+      aws_security_group_rule.nat_instance_additional_egress["1"].protocol == "udp" &&
+      aws_security_group_rule.nat_instance_additional_egress["1"].prefix_list_ids == tolist(["pl-0fedcba9876543210"])
+    )
+    error_message = "Expected only the listed egress traffic allowed."
+  }
+}
+
+run "egress_rules_need_a_destination" {
+  command = plan
+
+  variables {
+    nat_instance_security_group = {
+      egress_rules = [{ protocol = "tcp", from_port = 443, to_port = 443 }]
+    }
+  }
+
+  expect_failures = [
+    var.nat_instance_security_group,
+  ]
+}
+
+run "arm_instance_types_get_an_arm_ami" {
+  command = plan
+
+  variables {
+    nat_instance_type = "t4g.nano"
+  }
+
+  override_data {
+    target = data.aws_ec2_instance_type.nat_instance[0]
+    values = {
+      supported_architectures = ["arm64"]
+    }
+  }
+
+  assert {
+    condition     = anytrue([for f in data.aws_ami.nat_instance[0].filter : f.name == "architecture" && contains(f.values, "arm64")])
+    error_message = "Expected the AMI to be looked up for the arm64 architecture."
+  }
+}
+
+run "legacy_nat_ami_is_not_available_for_arm" {
+  command = plan
+
+  variables {
+    nat_instance_type       = "t4g.nano"
+    nat_instance_ami_family = "amzn-ami-vpc-nat"
+  }
+
+  override_data {
+    target = data.aws_ec2_instance_type.nat_instance[0]
+    values = {
+      supported_architectures = ["arm64"]
+    }
+  }
+
+  expect_failures = [
+    data.aws_ami.nat_instance,
+  ]
+}
+
+run "spot_nat_instances_stop_when_interrupted" {
+  command = plan
+
+  variables {
+    nat_instance_spot = {
+      enabled   = true
+      max_price = "0.01"
+    }
+  }
+
+  assert {
+    condition = alltrue([
+      for i in values(aws_instance.nat_instance) : (
+        i.instance_market_options[0].market_type == "spot" &&
+        i.instance_market_options[0].spot_options[0].instance_interruption_behavior == "stop" &&
+        i.instance_market_options[0].spot_options[0].spot_instance_type == "persistent" &&
+        i.instance_market_options[0].spot_options[0].max_price == "0.01"
+      )
+    ])
+    error_message = "Expected persistent Spot requests that stop the NAT instances when interrupted."
+  }
+}
+
+run "spot_nat_instances_can_terminate_when_interrupted" {
+  command = plan
+
+  variables {
+    nat_instance_spot = {
+      enabled               = true
+      interruption_behavior = "terminate"
+    }
+  }
+
+  assert {
+    condition = alltrue([
+      for i in values(aws_instance.nat_instance) : (
+        i.instance_market_options[0].market_type == "spot" &&
+        i.instance_market_options[0].spot_options[0].instance_interruption_behavior == "terminate" &&
+        i.instance_market_options[0].spot_options[0].spot_instance_type == "one-time"
+      )
+    ])
+    error_message = "Expected one-time Spot requests that terminate the NAT instances when interrupted."
+  }
+}
+
+run "spot_nat_instances_cannot_hibernate" {
+  command = plan
+
+  variables {
+    nat_instance_spot = {
+      enabled               = true
+      interruption_behavior = "hibernate"
+    }
+  }
+
+  expect_failures = [
+    var.nat_instance_spot,
+  ]
+}
+
+run "on_demand_nat_instances_have_no_market_options" {
+  command = plan
+
+  assert {
+    condition     = alltrue([for i in values(aws_instance.nat_instance) : length(i.instance_market_options) == 0])
+    error_message = "Expected On-Demand NAT instances by default."
+  }
+}
+
+run "auto_scaling_groups_request_spot_instances" {
+  command = plan
+
+  variables {
+    nat_instance_auto_scaling_group_enabled = true
+    nat_instance_spot = {
+      enabled   = true
+      max_price = "0.01"
+    }
+  }
+
+  assert {
+    condition = alltrue([
+      for k, g in aws_autoscaling_group.nat_instance : (
+        length(g.launch_template) == 0 &&
+        g.mixed_instances_policy[0].instances_distribution[0].on_demand_base_capacity == 0 &&
+        g.mixed_instances_policy[0].instances_distribution[0].on_demand_percentage_above_base_capacity == 0 &&
+        g.mixed_instances_policy[0].instances_distribution[0].spot_allocation_strategy == "price-capacity-optimized" &&
+        g.mixed_instances_policy[0].instances_distribution[0].spot_max_price == "0.01" &&
+        g.mixed_instances_policy[0].launch_template[0].launch_template_specification[0].launch_template_id == aws_launch_template.nat_instance[k].id
+      )
+    ])
+    error_message = "Expected the Auto Scaling groups to request only Spot Instances, from their launch templates."
+  }
+
+  assert {
+    condition     = alltrue([for t in values(aws_launch_template.nat_instance) : length(t.instance_market_options) == 0])
+    error_message = "Expected the Auto Scaling groups, not the launch templates, to request the Spot Instances."
+  }
+}
+
+run "auto_scaling_groups_can_terminate_spot_instances" {
+  command = plan
+
+  variables {
+    nat_instance_auto_scaling_group_enabled = true
+    nat_instance_spot = {
+      enabled               = true
+      interruption_behavior = "terminate"
+    }
+  }
+
+  assert {
+    condition     = alltrue([for g in values(aws_autoscaling_group.nat_instance) : g.mixed_instances_policy[0].instances_distribution[0].on_demand_percentage_above_base_capacity == 0])
+    error_message = "Expected the Auto Scaling groups to request only Spot Instances."
+  }
+}
+
+run "auto_scaling_groups_cannot_stop_spot_instances" {
+  command = plan
+
+  variables {
+    nat_instance_auto_scaling_group_enabled = true
+    nat_instance_spot = {
+      enabled               = true
+      interruption_behavior = "stop"
+    }
+  }
+
+  expect_failures = [
+    aws_autoscaling_group.nat_instance,
+  ]
+}
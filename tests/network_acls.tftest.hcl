@@ -0,0 +1,417 @@
+# Tests for the network ACL rules managed by the module.
+# These use a mocked AWS provider, so they need no AWS credentials: run them with `terraform test`.
+
+mock_provider "aws" {
+  mock_data "aws_availability_zones" {
+    defaults = {
+      names    = ["us-east-2a", "us-east-2b", "us-east-2c"]
+      zone_ids = ["use2-az1", "use2-az2", "use2-az3"]
+    }
+  }
+}
+
+variables {
+  vpc_id                           = "vpc-0123456789abcdef0"
+  igw_id                           = ["igw-0123456789abcdef0"]
+  availability_zones               = ["us-east-2a", "us-east-2b"]
+  ipv4_cidr_block                  = ["10.0.0.0/16"]
+  nat_gateway_enabled              = false
+  private_open_network_acl_enabled = false
+  subnet_tiers = {
+    data = {
+      egress               = "none"
+      subnets_per_az_sizes = { data = { newbits = 4 } }
+    }
+  }
+  network_acl_rules = {
+    private = {
+      ingress = [
+        { rule_number = 10, protocol = "tcp", from_port = 443, to_port = 443, cidr_block = "10.0.0.0/16" },
+        { rule_number = 20, protocol = "tcp", from_port = 1024, to_port = 65535, cidr_block = "0.0.0.0/0" },
+      ]
+      egress = [
+        { rule_number = 10, cidr_block = "0.0.0.0/0" },
+      ]
+    }
+    data = {
+      ingress = [
+        { rule_number = 10, rule_action = "deny", protocol = "tcp", from_port = 3389, to_port = 3389, cidr_block = "0.0.0.0/0" },
+      ]
+    }
+  }
+}
+
+run "rules_are_managed_in_the_tier_network_acls" {
+  assert {
+    condition = keys(aws_network_acl_rule.rules) == [
+      "data/ingress/10",
+      "private/egress/10",
+      "private/ingress/10",
+      "private/ingress/20",
+    ]
+    error_message = "Expected a rule per entry, keyed by tier, direction and rule number."
+  }
+
+  assert {
+    condition = (
+      aws_network_acl_rule.rules["private/ingress/10"].network_acl_id == aws_network_acl.private[0].id &&
+      aws_network_acl_rule.rules["private/ingress/10"].from_port == 443 &&
+      !aws_network_acl_rule.rules["private/ingress/10"].egress &&
+      aws_network_acl_rule.rules["private/egress/10"].egress &&
+      aws_network_acl_rule.rules["data/ingress/10"].network_acl_id == aws_network_acl.tier["data"].id &&
+      aws_network_acl_rule.rules["data/ingress/10"].rule_action == "deny"
+    )
+    error_message = "Expected the rules in the network ACL of their tier."
+  }
+
+  assert {
+    condition     = length(aws_network_acl_rule.private4_ingress) == 0 && length(aws_network_acl_rule.tier4_ingress) == 1
+    error_message = "Expected the private network ACL to have only the listed rules, and the data one to keep its open rule."
+  }
+}
+
+run "rule_numbers_must_not_collide" {
+  command = plan
+
+  variables {
+    network_acl_rules = {
+      private = {
+        ingress = [
+          { rule_number = 10, cidr_block = "10.0.0.0/16" },
+          { rule_number = 10, ipv6_cidr_block = "::/0" },
+        ]
+      }
+    }
+  }
+
+  expect_failures = [
+    var.network_acl_rules,
+  ]
+}
+
+run "rule_numbers_must_not_collide_with_open_rules" {
+  command = plan
+
+  variables {
+    network_acl_rules = {
+      data = {
+        egress = [
+          { rule_number = 100, cidr_block = "10.0.0.0/16" },
+        ]
+      }
+    }
+  }
+
+  expect_failures = [
+    aws_network_acl_rule.rules,
+  ]
+}
+
+run "rule_tiers_must_exist" {
+  command = plan
+
+  variables {
+    network_acl_rules = {
+      cache = {
+        ingress = [
+          { rule_number = 10, protocol = "tcp", from_port = 6379, to_port = 6379, cidr_block = "10.0.0.0/16" },
+        ]
+      }
+    }
+  }
+
+  expect_failures = [
+    aws_network_acl_rule.rules,
+  ]
+}
+
+run "named_subnets_get_their_own_network_acl" {
+  variables {
+    private_open_network_acl_enabled = true
+    private_subnets_per_az_count     = 2
+    private_subnets_per_az_names     = ["app", "database"]
+    network_acl_rules                = {}
+    named_network_acl_rules = {
+      private = {
+        database = {
+          ingress = [
+            { rule_number = 10, protocol = "tcp", from_port = 5432, to_port = 5432, cidr_block = "10.0.0.0/16" },
+          ]
+          egress = [
+            { rule_number = 10, protocol = "tcp", from_port = 1024, to_port = 65535, cidr_block = "10.0.0.0/16" },
+          ]
+        }
+      }
+    }
+  }
+
+  assert {
+    condition = (
+      aws_network_acl.named["private/database"].subnet_ids == toset([aws_subnet.private["use2a/database"].id, aws_subnet.private["use2b/database"].id]) &&
+      aws_network_acl.private[0].subnet_ids == toset([aws_subnet.private["use2a/app"].id, aws_subnet.private["use2b/app"].id])
+    )
+    error_message = "Expected the database subnets in their own network ACL, and only the app subnets in the private one."
+  }
+
+  assert {
+    condition = (
+      keys(aws_network_acl_rule.rules) == ["private/database/egress/10", "private/database/ingress/10"] &&
+      aws_network_acl_rule.rules["private/database/ingress/10"].network_acl_id == aws_network_acl.named["private/database"].id
+    )
+    error_message = "Expected the rules in the database network ACL."
+  }
+
+  assert {
+    condition = (
+      output.named_private_network_acl_ids_map["database"] == aws_network_acl.named["private/database"].id &&
+      output.named_private_network_acl_ids_map["app"] == aws_network_acl.private[0].id
+    )
+    error_message = "Expected the network ACL IDs to be output by subnet name."
+  }
+}
+
+run "named_network_acl_subnets_must_exist" {
+  command = plan
+
+  variables {
+    network_acl_rules = {}
+    named_network_acl_rules = {
+      private = {
+        database = {}
+      }
+    }
+  }
+
+  expect_failures = [
+    aws_network_acl.named,
+  ]
+}
+
+run "presets_generate_the_rules" {
+  command = plan
+
+  variables {
+    network_acl_rules = {
+      private = {
+        preset             = "hardened-private"
+        trusted_ipv4_cidrs = ["192.168.0.0/24"]
+        ingress = [
+          { rule_number = 10, protocol = "tcp", from_port = 22, to_port = 22, cidr_block = "172.16.0.0/24" },
+        ]
+      }
+      data = {
+        preset = "deny-admin-ports"
+      }
+    }
+  }
+
+  assert {
+    condition = [for k in keys(aws_network_acl_rule.rules) : k if startswith(k, "private/")] == [
+      "private/egress/1500",
+      "private/ingress/10",
+      "private/ingress/1000",
+      "private/ingress/1001",
+      "private/ingress/1100",
+      "private/ingress/1101",
+      "private/ingress/1200",
+      "private/ingress/1400",
+      "private/ingress/1401",
+    ]
+    error_message = "Expected the listed rule and the hardened private preset rules."
+  }
+
+  assert {
+    condition = (
+      aws_network_acl_rule.rules["private/ingress/1000"].cidr_block == "10.0.0.0/16" &&
+      aws_network_acl_rule.rules["private/ingress/1001"].cidr_block == "192.168.0.0/24" &&
+      aws_network_acl_rule.rules["private/ingress/1101"].rule_action == "deny" &&
+      aws_network_acl_rule.rules["private/ingress/1101"].from_port == 3389 &&
+      aws_network_acl_rule.rules["private/ingress/1401"].protocol == "udp" &&
+      aws_network_acl_rule.rules["private/ingress/1401"].from_port == 1024 &&
+      aws_network_acl_rule.rules["private/ingress/1200"].icmp_type == 3
+    )
+    error_message = "Expected the VPC and extra CIDRs trusted, the admin ports denied, and return traffic allowed."
+  }
+
+  assert {
+    condition = (
+      contains(keys(aws_network_acl_rule.rules), "data/ingress/1500") &&
+      length(aws_network_acl_rule.private4_ingress) == 0 && length(aws_network_acl_rule.tier4_ingress) == 0
+    )
+    error_message = "Expected the presets to replace the open rules."
+  }
+}
+
+run "presets_cover_ipv6" {
+  command = plan
+
+  variables {
+    ipv6_enabled    = true
+    ipv6_cidr_block = ["2600:1f16:c52:ab00::/56"]
+    network_acl_rules = {
+      public = {
+        preset = "hardened-public"
+      }
+    }
+  }
+
+  assert {
+    condition = (
+      aws_network_acl_rule.rules["public/ingress/1001"].ipv6_cidr_block == "2600:1f16:c52:ab00::/56" &&
+      aws_network_acl_rule.rules["public/ingress/1200"].icmp_type == 3 &&
+      aws_network_acl_rule.rules["public/ingress/1201"].protocol == "58" &&
+      aws_network_acl_rule.rules["public/ingress/1303"].ipv6_cidr_block == "::/0" &&
+      aws_network_acl_rule.rules["public/ingress/1303"].from_port == 443 &&
+      aws_network_acl_rule.rules["public/ingress/1403"].ipv6_cidr_block == "::/0" &&
+      aws_network_acl_rule.rules["public/egress/1501"].ipv6_cidr_block == "::/0"
+    )
+    error_message = "Expected the hardened public preset to cover IPv4 and IPv6."
+  }
+}
+
+run "named_network_acls_can_use_presets" {
+  command = plan
+
+  variables {
+    private_subnets_per_az_count = 2
+    private_subnets_per_az_names = ["app", "database"]
+    network_acl_rules            = {}
+    named_network_acl_rules = {
+      private = {
+        database = {
+          preset = "open"
+        }
+      }
+    }
+  }
+
+  assert {
+    condition     = keys(aws_network_acl_rule.rules) == ["private/database/egress/1500", "private/database/ingress/1500"]
+    error_message = "Expected the open preset to allow all traffic in the database network ACL."
+  }
+}
+
+run "presets_trust_at_most_100_cidrs" {
+  command = plan
+
+  variables {
+    network_acl_rules = {
+      private = {
+        preset             = "hardened-private"
+        trusted_ipv4_cidrs = [for i in range(100) : cidrsubnet("192.168.0.0/16", 8, i)]
+      }
+    }
+  }
+
+  expect_failures = [
+    aws_network_acl_rule.rules,
+  ]
+}
+
+run "presets_must_be_known" {
+  command = plan
+
+  variables {
+    network_acl_rules = {
+      private = {
+        preset = "closed"
+      }
+    }
+  }
+
+  expect_failures = [
+    var.network_acl_rules,
+  ]
+}
+
+run "subnets_can_use_existing_network_acls" {
+  command = plan
+
+  variables {
+    public_network_acl_ids       = ["acl-0123456789abcdef0"]
+    private_network_acl_ids      = ["acl-0000000000000000a", "acl-0000000000000000b", "acl-0000000000000000c", "acl-0000000000000000d"]
+    private_subnets_per_az_count = 2
+    private_subnets_per_az_names = ["app", "database"]
+    network_acl_rules            = {}
+    named_network_acl_ids = {
+      data = {
+        data = "acl-0fedcba9876543210"
+      }
+    }
+  }
+
+  assert {
+    condition = keys(aws_network_acl_association.default) == [
+      "data/use2a/data",
+      "data/use2b/data",
+      "private/use2a/app",
+      "private/use2a/database",
+      "private/use2b/app",
+      "private/use2b/database",
+      "public/use2a/common",
+      "public/use2b/common",
+    ]
+    error_message = "Expected an association for every subnet with a supplied network ACL."
+  }
+
+  assert {
+    condition = (
+      aws_network_acl_association.default["public/use2b/common"].network_acl_id == "acl-0123456789abcdef0" &&
+      aws_network_acl_association.default["private/use2a/database"].network_acl_id == "acl-0000000000000000b" &&
+      aws_network_acl_association.default["private/use2b/app"].network_acl_id == "acl-0000000000000000c" &&
+      aws_network_acl_association.default["data/use2a/data"].network_acl_id == "acl-0fedcba9876543210"
+    )
+    error_message = "Expected a single network ACL for every public subnet, and one per private subnet."
+  }
+
+  assert {
+    condition = (
+      length(aws_network_acl.public) == 0 && length(aws_network_acl.private) == 0 && length(aws_network_acl.tier) == 0 &&
+      output.named_public_network_acl_ids_map["common"] == "acl-0123456789abcdef0" &&
+      output.named_private_network_acl_ids_map["app"] == null
+    )
+    error_message = "Expected no network ACLs created for subnets with supplied ones."
+  }
+}
+
+run "existing_network_acls_need_one_per_subnet" {
+  command = plan
+
+  variables {
+    private_network_acl_ids = ["acl-0000000000000000a", "acl-0000000000000000b", "acl-0000000000000000c"]
+    network_acl_rules       = {}
+  }
+
+  expect_failures = [
+    aws_network_acl_association.default,
+  ]
+}
+
+run "existing_network_acls_need_a_known_tier" {
+  command = plan
+
+  variables {
+    network_acl_rules = {}
+    named_network_acl_ids = {
+      database = {
+        data = "acl-0fedcba9876543210"
+      }
+    }
+  }
+
+  expect_failures = [
+    aws_network_acl_association.default,
+  ]
+}
+
+run "existing_network_acls_are_not_managed" {
+  command = plan
+
+  variables {
+    private_network_acl_ids = ["acl-0123456789abcdef0"]
+  }
+
+  expect_failures = [
+    aws_network_acl_rule.rules,
+  ]
+}
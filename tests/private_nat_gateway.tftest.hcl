@@ -0,0 +1,168 @@
+# Tests for private NAT Gateways, which let a tier with non-routable CIDRs reach other private networks.
+# These use a mocked AWS provider, so they need no AWS credentials: run them with `terraform test`.
+
+mock_provider "aws" {
+  mock_data "aws_availability_zones" {
+    defaults = {
+      names    = ["us-east-2a", "us-east-2b", "us-east-2c"]
+      zone_ids = ["use2-az1", "use2-az2", "use2-az3"]
+    }
+  }
+}
+
+variables {
+  vpc_id                       = "vpc-0123456789abcdef0"
+  igw_id                       = ["igw-0123456789abcdef0"]
+  availability_zones           = ["us-east-2a", "us-east-2b"]
+  ipv4_cidr_block              = ["10.0.0.0/16"]
+  nat_gateway_enabled          = false
+  private_subnets_per_az_count = 2
+  private_subnets_per_az_names = ["app", "transit"]
+  subnet_tiers = {
+    pods = {
+      egress          = "none"
+      ipv4_cidr_block = "100.64.0.0/16"
+    }
+  }
+  private_nat_gateway = {
+    enabled                     = true
+    subnet_name                 = "transit"
+    subnet_tiers                = ["pods"]
+    destination_cidrs           = ["10.0.0.0/8"]
+    destination_prefix_list_ids = ["pl-0123456789abcdef0"]
+  }
+}
+
+run "private_nat_gateways_go_in_the_named_subnets" {
+  assert {
+    condition = (
+      keys(aws_nat_gateway.private) == ["use2a/transit", "use2b/transit"] &&
+      aws_nat_gateway.private["use2b/transit"].connectivity_type == "private" &&
+      aws_nat_gateway.private["use2b/transit"].subnet_id == aws_subnet.private["use2b/transit"].id
+    )
+    error_message = "Expected a private NAT Gateway in the transit subnet of each AZ."
+  }
+
+  assert {
+    condition     = length(aws_nat_gateway.default) == 0 && length(aws_eip.default) == 0
+    error_message = "Expected no public NAT Gateways."
+  }
+}
+
+run "routes_go_to_the_private_nat_gateway_in_the_same_az" {
+  assert {
+    condition = keys(aws_route.private_nat_gateway) == [
+      "pods/use2a/pods/10.0.0.0/8",
+      "pods/use2a/pods/pl-0123456789abcdef0",
+      "pods/use2b/pods/10.0.0.0/8",
+      "pods/use2b/pods/pl-0123456789abcdef0",
+    ]
+    error_message = "Expected a route per destination in each route table of the pods tier."
+  }
+
+  assert {
+    condition = (
+      aws_route.private_nat_gateway["pods/use2b/pods/10.0.0.0/8"].route_table_id == aws_route_table.tier["pods/use2b/pods"].id &&
+      aws_route.private_nat_gateway["pods/use2b/pods/10.0.0.0/8"].nat_gateway_id == aws_nat_gateway.private["use2b/transit"].id &&
+      aws_route.private_nat_gateway["pods/use2a/pods/pl-0123456789abcdef0"].destination_prefix_list_id == "pl-0123456789abcdef0"
+    )
+    error_message = "Expected each route table to use the private NAT Gateway in its own AZ."
+  }
+}
+
+run "max_nats_wraps_around" {
+  variables {
+    max_nats = 1
+  }
+
+  assert {
+    condition = (
+      keys(aws_nat_gateway.private) == ["use2a/transit"] &&
+      aws_route.private_nat_gateway["pods/use2b/pods/10.0.0.0/8"].nat_gateway_id == aws_nat_gateway.private["use2a/transit"].id
+    )
+    error_message = "Expected the only private NAT Gateway to serve both AZs."
+  }
+}
+
+run "the_subnets_of_the_private_nat_gateways_do_not_route_to_them" {
+  command = plan
+
+  variables {
+    private_nat_gateway = {
+      enabled           = true
+      subnet_name       = "transit"
+      subnet_tiers      = ["private"]
+      destination_cidrs = ["10.0.0.0/8"]
+    }
+  }
+
+  assert {
+    condition     = keys(aws_route.private_nat_gateway) == ["private/use2a/app/10.0.0.0/8", "private/use2b/app/10.0.0.0/8"]
+    error_message = "Expected routes from the app route tables only, not from the transit route tables the NAT Gateways are in."
+  }
+}
+
+run "default_route_is_rejected" {
+  command = plan
+
+  variables {
+    private_nat_gateway = {
+      enabled           = true
+      subnet_name       = "transit"
+      subnet_tiers      = ["pods"]
+      destination_cidrs = ["0.0.0.0/0"]
+    }
+  }
+
+  expect_failures = [
+    var.private_nat_gateway,
+  ]
+}
+
+run "ipv6_destinations_are_rejected" {
+  command = plan
+
+  variables {
+    private_nat_gateway = {
+      enabled           = true
+      subnet_name       = "transit"
+      subnet_tiers      = ["pods"]
+      destination_cidrs = ["::/0"]
+    }
+  }
+
+  expect_failures = [
+    var.private_nat_gateway,
+  ]
+}
+
+run "secondary_private_ips_are_limited_to_31" {
+  command = plan
+
+  variables {
+    private_nat_gateway = {
+      enabled                            = true
+      subnet_name                        = "transit"
+      secondary_private_ip_address_count = 32
+    }
+  }
+
+  expect_failures = [
+    var.private_nat_gateway,
+  ]
+}
+
+run "subnet_name_must_exist" {
+  command = plan
+
+  variables {
+    private_nat_gateway = {
+      enabled     = true
+      subnet_name = "egress"
+    }
+  }
+
+  expect_failures = [
+    aws_nat_gateway.private,
+  ]
+}
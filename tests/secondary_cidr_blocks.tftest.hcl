@@ -0,0 +1,125 @@
+# Tests for placing subnets in secondary CIDR blocks of the VPC.
+# These use a mocked AWS provider, so they need no AWS credentials: run them with `terraform test`.
+
+mock_provider "aws" {
+  mock_data "aws_availability_zones" {
+    defaults = {
+      names    = ["us-east-2a", "us-east-2b", "us-east-2c"]
+      zone_ids = ["use2-az1", "use2-az2", "use2-az3"]
+    }
+  }
+}
+
+variables {
+  vpc_id                       = "vpc-0123456789abcdef0"
+  igw_id                       = ["igw-0123456789abcdef0"]
+  availability_zones           = ["us-east-2a", "us-east-2b"]
+  ipv4_cidr_block              = ["10.0.0.0/16"]
+  nat_gateway_enabled          = false
+  nat_instance_enabled         = true
+  private_subnets_per_az_count = 2
+  private_subnets_per_az_names = ["app", "pods"]
+  subnet_tiers = {
+    private = {
+      ipv4_cidr_block = "10.1.0.0/16"
+      subnet_ipv4_cidr_blocks = {
+        pods = "100.64.0.0/16"
+      }
+    }
+  }
+}
+
+run "each_cidr_block_is_divided_separately" {
+  command = plan
+
+  assert {
+    condition     = [for s in aws_subnet.private : s.cidr_block] == ["10.1.0.0/18", "100.64.0.0/18", "10.1.64.0/18", "100.64.64.0/18"]
+    error_message = "Expected the app subnets in 10.1.0.0/16 and the pods subnets in 100.64.0.0/16."
+  }
+
+  assert {
+    condition     = [for s in aws_subnet.public : s.cidr_block] == ["10.0.0.0/18", "10.0.64.0/18"]
+    error_message = "Expected the public subnets to stay in the base CIDR block."
+  }
+}
+
+run "nat_instance_accepts_traffic_from_the_private_subnets_in_every_cidr_block" {
+  command = plan
+
+  assert {
+    condition     = toset(aws_security_group_rule.nat_instance_ingress[0].cidr_blocks) == toset(["10.1.0.0/18", "100.64.0.0/18", "10.1.64.0/18", "100.64.64.0/18"])
+    error_message = "Expected the NAT instance to accept traffic from the private subnets in both secondary CIDR blocks."
+  }
+}
+
+run "sizes_apply_within_the_secondary_cidr_block" {
+  command = plan
+
+  variables {
+    private_subnets_per_az_sizes = {
+      pods = {
+        newbits = 2
+      }
+      app = {
+        host_count = 1000
+      }
+    }
+  }
+
+  assert {
+    condition     = [for s in aws_subnet.private : s.cidr_block] == ["10.1.0.0/22", "100.64.0.0/18", "10.1.4.0/22", "100.64.64.0/18"]
+    error_message = "Expected the sizes to be relative to the CIDR block each subnet is placed in."
+  }
+}
+
+run "sizes_must_fit_in_their_cidr_block" {
+  command = plan
+
+  variables {
+    availability_zones           = ["us-east-2a", "us-east-2b", "us-east-2c"]
+    private_subnets_per_az_names = ["app", "big"]
+    subnet_tiers                 = {}
+    private_subnets_per_az_sizes = {
+      big = {
+        newbits = 2
+      }
+    }
+  }
+
+  expect_failures = [
+    terraform_data.subnet_cidrs,
+  ]
+}
+
+run "host_count_sizes_are_at_least_a_slash_28" {
+  command = plan
+
+  variables {
+    private_subnets_per_az_sizes = {
+      app = {
+        host_count = 3
+      }
+    }
+  }
+
+  assert {
+    condition     = aws_subnet.private["use2a/app"].cidr_block == "10.1.0.0/28" && aws_subnet.private["use2b/app"].cidr_block == "10.1.0.16/28"
+    error_message = "Expected a small host_count to get a /28, the smallest subnet AWS allows."
+  }
+}
+
+run "sizes_must_not_be_smaller_than_a_slash_28" {
+  command = plan
+
+  variables {
+    private_subnets_per_az_sizes = {
+      pods = {
+        newbits = 13
+      }
+    }
+  }
+
+  expect_failures = [
+    terraform_data.subnet_cidrs,
+  ]
+}
@@ -0,0 +1,216 @@
+# Tests for configuring subnet tiers with `subnet_tiers`.
+# These use a mocked AWS provider, so they need no AWS credentials: run them with `terraform test`.
+
+mock_provider "aws" {
+  mock_data "aws_availability_zones" {
+    defaults = {
+      names    = ["us-east-2a", "us-east-2b", "us-east-2c"]
+      zone_ids = ["use2-az1", "use2-az2", "use2-az3"]
+    }
+  }
+}
+
+variables {
+  vpc_id              = "vpc-0123456789abcdef0"
+  igw_id              = ["igw-0123456789abcdef0"]
+  availability_zones  = ["us-east-2a", "us-east-2b"]
+  ipv4_cidr_block     = ["10.0.0.0/16"]
+  nat_gateway_enabled = false
+  subnet_tiers = {
+    app = {
+      egress               = "nat"
+      subnets_per_az_sizes = { app = { newbits = 4 } }
+    }
+    data = {
+      egress  = "none"
+      enabled = false
+    }
+  }
+}
+
+run "disabled_tiers_create_nothing" {
+  command = plan
+
+  assert {
+    condition = (
+      keys(aws_subnet.tier) == ["app/use2a/app", "app/use2b/app"] &&
+      keys(aws_route_table.tier) == ["app/use2a/app", "app/use2b/app"] &&
+      keys(aws_network_acl.tier) == ["app"]
+    )
+    error_message = "Expected only the app tier to have subnets, route tables, and a network ACL."
+  }
+
+  assert {
+    condition     = length(output.tier_route_table_ids["data"]) == 0
+    error_message = "Expected the disabled data tier to have no route tables."
+  }
+}
+
+run "subnets_per_az_count_without_names" {
+  command = plan
+
+  variables {
+    subnet_tiers = {
+      app = {
+        egress               = "nat"
+        subnets_per_az_count = 2
+        subnets_per_az_sizes = { "0" = { newbits = 5 }, "1" = { newbits = 5 } }
+      }
+    }
+  }
+
+  assert {
+    condition     = keys(aws_subnet.tier) == ["app/use2a/0", "app/use2a/1", "app/use2b/0", "app/use2b/1"]
+    error_message = "Expected 2 subnets per AZ, named by their position."
+  }
+}
+
+run "built_in_tiers_can_be_enabled_in_subnet_tiers" {
+  command = plan
+
+  variables {
+    subnet_tiers = {
+      intra = {
+        enabled              = true
+        subnets_per_az_sizes = { common = { newbits = 4 } }
+      }
+      public = {
+        enabled = false
+      }
+    }
+  }
+
+  assert {
+    condition     = length(aws_subnet.intra) == 2 && length(aws_subnet.public) == 0 && length(aws_subnet.private) == 2
+    error_message = "Expected `enabled` in `subnet_tiers` to override `intra_subnets_enabled` and `public_subnets_enabled`."
+  }
+}
+
+run "intra_subnets_do_not_move_the_private_and_public_subnets" {
+  command = plan
+
+  variables {
+    subnet_tiers = {
+      intra = {
+        enabled              = true
+        subnets_per_az_sizes = { common = { newbits = 4 } }
+      }
+    }
+  }
+
+  assert {
+    condition = (
+      [for s in aws_subnet.private : s.cidr_block] == ["10.0.0.0/19", "10.0.32.0/19"] &&
+      [for s in aws_subnet.public : s.cidr_block] == ["10.0.96.0/19", "10.0.128.0/19"]
+    )
+    error_message = "Expected the private and public subnets to keep the CIDRs they have without the intra subnets."
+  }
+
+  assert {
+    condition     = [for s in aws_subnet.intra : s.cidr_block] == ["10.0.192.0/20", "10.0.208.0/20"]
+    error_message = "Expected the intra subnets in the space left over after the public subnets."
+  }
+}
+
+run "intra_subnets_must_fit_after_the_private_and_public_subnets" {
+  command = plan
+
+  variables {
+    subnet_tiers = {
+      intra = {
+        enabled = true
+      }
+    }
+  }
+
+  expect_failures = [
+    terraform_data.subnet_cidrs,
+  ]
+}
+
+run "additional_tiers_go_after_the_private_and_public_subnets" {
+  command = plan
+
+  variables {
+    subnet_tiers = {
+      app = {
+        egress               = "nat"
+        subnets_per_az_sizes = { app = { newbits = 5 } }
+      }
+    }
+  }
+
+  assert {
+    condition = (
+      [for s in aws_subnet.private : s.cidr_block] == ["10.0.0.0/19", "10.0.32.0/19"] &&
+      [for s in aws_subnet.public : s.cidr_block] == ["10.0.96.0/19", "10.0.128.0/19"] &&
+      [for s in aws_subnet.tier : s.cidr_block] == ["10.0.192.0/21", "10.0.200.0/21"]
+    )
+    error_message = "Expected the app subnets in the space left over after the public subnets."
+  }
+}
+
+run "adding_a_tier_that_sorts_last_moves_no_cidrs" {
+  command = plan
+
+  variables {
+    subnet_tiers = {
+      app = {
+        egress               = "nat"
+        subnets_per_az_sizes = { app = { newbits = 5 } }
+      }
+      data = {
+        egress               = "none"
+        subnets_per_az_sizes = { data = { newbits = 5 } }
+      }
+    }
+  }
+
+  assert {
+    condition = (
+      [for s in aws_subnet.private : s.cidr_block] == ["10.0.0.0/19", "10.0.32.0/19"] &&
+      [for s in aws_subnet.public : s.cidr_block] == ["10.0.96.0/19", "10.0.128.0/19"] &&
+      [for k in ["app/use2a/app", "app/use2b/app"] : aws_subnet.tier[k].cidr_block] == ["10.0.192.0/21", "10.0.200.0/21"]
+    )
+    error_message = "Expected adding the data tier to leave the CIDRs of the other tiers alone."
+  }
+
+  assert {
+    condition     = [for k in ["data/use2a/data", "data/use2b/data"] : aws_subnet.tier[k].cidr_block] == ["10.0.216.0/21", "10.0.224.0/21"]
+    error_message = "Expected the data subnets after the app subnets of every AZ."
+  }
+}
+
+run "additional_tiers_must_fit_after_the_private_and_public_subnets" {
+  command = plan
+
+  variables {
+    subnet_tiers = {
+      app = {
+        egress = "nat"
+      }
+    }
+  }
+
+  expect_failures = [
+    terraform_data.subnet_cidrs,
+  ]
+}
+
+run "built_in_tiers_can_be_labelled_in_subnet_tiers" {
+  command = plan
+
+  variables {
+    subnet_tiers = {
+      private = {
+        label           = "app"
+        additional_tags = { Team = "app" }
+      }
+    }
+  }
+
+  assert {
+    condition     = startswith(aws_subnet.private["use2a/common"].tags["Name"], "app") && aws_subnet.private["use2a/common"].tags["Team"] == "app"
+    error_message = "Expected `label` and `additional_tags` in `subnet_tiers` to override `private_label` and `private_subnets_additional_tags`."
+  }
+}
@@ -0,0 +1,126 @@
+# Tests for attaching the VPC to a Transit Gateway and routing to it.
+# These use a mocked AWS provider, so they need no AWS credentials: run them with `terraform test`.
+
+mock_provider "aws" {
+  mock_data "aws_availability_zones" {
+    defaults = {
+      names    = ["us-east-2a", "us-east-2b", "us-east-2c"]
+      zone_ids = ["use2-az1", "use2-az2", "use2-az3"]
+    }
+  }
+}
+
+variables {
+  vpc_id                       = "vpc-0123456789abcdef0"
+  igw_id                       = ["igw-0123456789abcdef0"]
+  availability_zones           = ["us-east-2a", "us-east-2b"]
+  ipv4_cidr_block              = ["10.0.0.0/16"]
+  nat_gateway_enabled          = false
+  private_subnets_per_az_count = 2
+  private_subnets_per_az_names = ["app", "tgw"]
+  subnet_tiers = {
+    data = {
+      egress = "none"
+    }
+  }
+  transit_gateway_id = ["tgw-0123456789abcdef0"]
+  transit_gateway_attachment = {
+    subnet_name = "tgw"
+  }
+  transit_gateway_routes = {
+    private = {
+      ipv4_cidrs      = ["10.0.0.0/8"]
+      prefix_list_ids = ["pl-0123456789abcdef0"]
+    }
+    data = {
+      ipv4_cidrs = ["10.0.0.0/8"]
+    }
+  }
+}
+
+run "attachment_uses_the_named_subnet_in_each_az" {
+  assert {
+    condition     = output.transit_gateway_attachment_subnet_ids == [aws_subnet.private["use2a/tgw"].id, aws_subnet.private["use2b/tgw"].id]
+    error_message = "Expected the attachment to use the tgw subnet in each AZ."
+  }
+
+  assert {
+    condition = (
+      aws_ec2_transit_gateway_vpc_attachment.default[0].dns_support == "enable" &&
+      aws_ec2_transit_gateway_vpc_attachment.default[0].ipv6_support == "disable" &&
+      output.transit_gateway_vpc_attachment_id == aws_ec2_transit_gateway_vpc_attachment.default[0].id
+    )
+    error_message = "Expected DNS support, and no IPv6 support since the private tier has no IPv6."
+  }
+}
+
+run "routes_are_added_to_every_route_table_of_the_tier" {
+  command = plan
+
+  assert {
+    condition = keys(aws_route.transit_gateway) == [
+      "data/use2a/data/10.0.0.0/8",
+      "data/use2b/data/10.0.0.0/8",
+      "private/use2a/app/10.0.0.0/8",
+      "private/use2a/app/pl-0123456789abcdef0",
+      "private/use2a/tgw/10.0.0.0/8",
+      "private/use2a/tgw/pl-0123456789abcdef0",
+      "private/use2b/app/10.0.0.0/8",
+      "private/use2b/app/pl-0123456789abcdef0",
+      "private/use2b/tgw/10.0.0.0/8",
+      "private/use2b/tgw/pl-0123456789abcdef0",
+    ]
+    error_message = "Expected a route for each destination in each route table of the private and data tiers."
+  }
+
+  assert {
+    condition = (
+      aws_route.transit_gateway["private/use2b/app/pl-0123456789abcdef0"].destination_prefix_list_id == "pl-0123456789abcdef0" &&
+      aws_route.transit_gateway["private/use2b/app/pl-0123456789abcdef0"].transit_gateway_id == "tgw-0123456789abcdef0"
+    )
+    error_message = "Expected the prefix list route to target the Transit Gateway."
+  }
+}
+
+run "routes_without_an_attachment" {
+  command = plan
+
+  variables {
+    transit_gateway_attachment_enabled = false
+  }
+
+  assert {
+    condition     = length(aws_ec2_transit_gateway_vpc_attachment.default) == 0 && length(aws_route.transit_gateway) == 10
+    error_message = "Expected the routes to be created without an attachment."
+  }
+}
+
+run "attachment_subnet_must_exist" {
+  command = plan
+
+  variables {
+    transit_gateway_attachment = {
+      subnet_name = "transit"
+    }
+  }
+
+  expect_failures = [
+    aws_ec2_transit_gateway_vpc_attachment.default,
+  ]
+}
+
+run "route_tiers_must_exist" {
+  command = plan
+
+  variables {
+    transit_gateway_routes = {
+      cache = {
+        ipv4_cidrs = ["10.0.0.0/8"]
+      }
+    }
+  }
+
+  expect_failures = [
+    aws_route.transit_gateway,
+  ]
+}
@@ -0,0 +1,175 @@
+# Tests for the VPC endpoints created by the module.
+# These use a mocked AWS provider, so they need no AWS credentials: run them with `terraform test`.
+
+mock_provider "aws" {
+  mock_data "aws_availability_zones" {
+    defaults = {
+      names    = ["us-east-2a", "us-east-2b", "us-east-2c"]
+      zone_ids = ["use2-az1", "use2-az2", "use2-az3"]
+    }
+  }
+
+  mock_data "aws_region" {
+    defaults = {
+      name   = "us-east-2"
+      region = "us-east-2"
+    }
+  }
+}
+
+variables {
+  vpc_id                       = "vpc-0123456789abcdef0"
+  igw_id                       = ["igw-0123456789abcdef0"]
+  availability_zones           = ["us-east-2a", "us-east-2b"]
+  ipv4_cidr_block              = ["10.0.0.0/16"]
+  nat_gateway_enabled          = false
+  private_subnets_per_az_count = 2
+  private_subnets_per_az_names = ["app", "db"]
+  gateway_vpc_endpoints = {
+    s3 = {}
+    dynamodb = {
+      policy       = "{\"Version\":\"2012-10-17\",\"Statement\":[{\"Effect\":\"Allow\",\"Principal\":\"*\",\"Action\":\"dynamodb:*\",\"Resource\":\"*\"}]}"
+      subnet_names = { private = ["app"] }
+    }
+  }
+}
+
+run "gateway_endpoints_use_the_chosen_route_tables" {
+  assert {
+    condition     = aws_vpc_endpoint.gateway["s3"].service_name == "com.amazonaws.us-east-2.s3" && aws_vpc_endpoint.gateway["s3"].vpc_endpoint_type == "Gateway"
+    error_message = "Expected the S3 service name to be derived from the region."
+  }
+
+  assert {
+    condition     = toset(aws_vpc_endpoint.gateway["s3"].route_table_ids) == toset([for rt in aws_route_table.private : rt.id])
+    error_message = "Expected the S3 endpoint to be associated with every private route table."
+  }
+
+  assert {
+    condition = toset(aws_vpc_endpoint.gateway["dynamodb"].route_table_ids) == toset([
+      aws_route_table.private["use2a/app"].id,
+      aws_route_table.private["use2b/app"].id,
+    ])
+    error_message = "Expected the DynamoDB endpoint to be associated with the app route tables only."
+  }
+
+  assert {
+    condition     = output.gateway_vpc_endpoint_ids["dynamodb"] == aws_vpc_endpoint.gateway["dynamodb"].id
+    error_message = "Expected the endpoint IDs to be output by key."
+  }
+}
+
+run "gateway_endpoint_subnets_must_exist" {
+  command = plan
+
+  variables {
+    gateway_vpc_endpoints = {
+      s3 = {
+        route_table_tiers = ["data"]
+      }
+    }
+  }
+
+  expect_failures = [
+    aws_vpc_endpoint.gateway,
+  ]
+}
+
+run "interface_endpoints_use_the_named_subnet_in_each_az" {
+  variables {
+    private_subnets_per_az_count = 3
+    private_subnets_per_az_names = ["app", "db", "endpoints"]
+    interface_vpc_endpoints = {
+      ssm       = {}
+      "ecr.api" = {}
+    }
+    interface_vpc_endpoint_subnet_name = "endpoints"
+  }
+
+  assert {
+    condition = (
+      aws_vpc_endpoint.interface["ecr.api"].service_name == "com.amazonaws.us-east-2.ecr.api" &&
+      aws_vpc_endpoint.interface["ecr.api"].vpc_endpoint_type == "Interface" &&
+      toset(aws_vpc_endpoint.interface["ssm"].subnet_ids) == toset([aws_subnet.private["use2a/endpoints"].id, aws_subnet.private["use2b/endpoints"].id])
+    )
+    error_message = "Expected the interface endpoints in the endpoints subnet of each AZ."
+  }
+
+  assert {
+    condition = (
+      aws_vpc_endpoint.interface["ssm"].security_group_ids == toset([aws_security_group.interface_vpc_endpoint[0].id]) &&
+      keys(aws_security_group_rule.interface_vpc_endpoint_ingress) == ["vpc"] &&
+      aws_security_group_rule.interface_vpc_endpoint_ingress["vpc"].from_port == 443 &&
+      aws_security_group_rule.interface_vpc_endpoint_ingress["vpc"].cidr_blocks == tolist(["10.0.0.0/16"])
+    )
+    error_message = "Expected the managed security group to allow HTTPS from the VPC CIDR block."
+  }
+
+  assert {
+    condition = (
+      output.az_interface_vpc_endpoints_map["ssm"]["us-east-2b"].subnet_id == aws_subnet.private["use2b/endpoints"].id &&
+      output.az_interface_vpc_endpoints_map["ssm"]["us-east-2b"].vpc_endpoint_id == output.interface_vpc_endpoint_ids["ssm"]
+    )
+    error_message = "Expected the endpoints to be output by service and AZ."
+  }
+}
+
+run "interface_endpoint_ingress_from_tiers" {
+  command = plan
+
+  variables {
+    interface_vpc_endpoints = {
+      sts = {}
+    }
+    interface_vpc_endpoint_security_group = {
+      allowed_subnet_tiers = ["private"]
+      allowed_ipv4_cidrs   = ["192.168.0.0/24"]
+    }
+  }
+
+  assert {
+    condition = (
+      length(aws_security_group_rule.interface_vpc_endpoint_ingress) == 5 &&
+      aws_security_group_rule.interface_vpc_endpoint_ingress["private/use2a/app"].cidr_blocks == tolist([aws_subnet.private["use2a/app"].cidr_block]) &&
+      aws_security_group_rule.interface_vpc_endpoint_ingress["allowed"].cidr_blocks == tolist(["192.168.0.0/24"])
+    )
+    error_message = "Expected HTTPS from the private subnet CIDRs and the additional CIDR."
+  }
+}
+
+run "interface_endpoint_ingress_is_planned_before_ipam_allocates_the_cidrs" {
+  command = plan
+
+  variables {
+    ipv4_cidr_block   = []
+    ipv4_ipam_pool_id = ["ipam-pool-0123456789abcdef0"]
+    interface_vpc_endpoints = {
+      sts = {}
+    }
+    interface_vpc_endpoint_security_group = {
+      allowed_subnet_tiers = ["private"]
+    }
+  }
+
+  assert {
+    condition = keys(aws_security_group_rule.interface_vpc_endpoint_ingress) == [
+      "private/use2a/app", "private/use2a/db", "private/use2b/app", "private/use2b/db"
+    ]
+    error_message = "Expected an ingress rule for each private subnet, even though their CIDRs are not known yet."
+  }
+}
+
+run "interface_endpoint_subnet_must_exist" {
+  command = plan
+
+  variables {
+    interface_vpc_endpoints = {
+      ssm = {}
+    }
+    interface_vpc_endpoint_subnet_name = "endpoints"
+  }
+
+  expect_failures = [
+    aws_vpc_endpoint.interface,
+  ]
+}
@@ -0,0 +1,244 @@
+# Subnets for the additional tiers configured via `subnet_tiers`.
+# The built-in `public`, `private`, and `intra` tiers are created in `public.tf`, `private.tf`, and `intra.tf`.
+
+module "tier_label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+
+  for_each = local.e ? local.additional_subnet_tiers : {}
+
+  attributes = [each.value.label]
+  tags = merge(
+    each.value.additional_tags,
+    var.subnet_type_tag_key != null && var.subnet_type_tag_value_format != null ? { (var.subnet_type_tag_key) = format(var.subnet_type_tag_value_format, each.value.label) } : {}
+  )
+
+  context = module.this.context
+}
+
+resource "aws_subnet" "tier" {
+  for_each = local.additional_tier_subnets
+
+  vpc_id            = local.vpc_id
+  availability_zone = each.value.availability_zone
+
+  cidr_block      = each.value.ipv4_cidr_block
+  ipv6_cidr_block = each.value.ipv6_cidr_block
+  ipv6_native     = each.value.ipv6_enabled && !each.value.ipv4_enabled
+
+  #bridgecrew:skip=BC_AWS_NETWORKING_53:Subnets routed to the Internet Gateway follow the public subnet setting
+  map_public_ip_on_launch = each.value.ipv4_enabled && each.value.egress == "igw" ? var.map_public_ip_on_launch : null
+
+  assign_ipv6_address_on_creation = each.value.ipv6_enabled ? (
+    each.value.egress == "igw" ? var.public_assign_ipv6_address_on_creation : var.private_assign_ipv6_address_on_creation
+  ) : null
+  enable_dns64 = each.value.ipv6_enabled ? each.value.dns64_enabled : null
+
+  enable_resource_name_dns_a_record_on_launch = each.value.ipv4_enabled ? (
+    each.value.egress == "igw" ? var.ipv4_public_instance_hostnames_enabled : var.ipv4_private_instance_hostnames_enabled
+  ) : null
+  enable_resource_name_dns_aaaa_record_on_launch = each.value.ipv6_enabled ? (
+    (each.value.egress == "igw" ? var.ipv6_public_instance_hostnames_enabled : var.ipv6_private_instance_hostnames_enabled) || !each.value.ipv4_enabled
+  ) : null
+
+  private_dns_hostname_type_on_launch = each.value.ipv4_enabled ? (
+    each.value.egress == "igw" ? var.ipv4_public_instance_hostname_type : var.ipv4_private_instance_hostname_type
+  ) : null
+
+  tags = merge(
+    module.tier_label[each.value.tier].tags,
+    {
+      "Name" = join(local.delimiter, compact([module.tier_label[each.value.tier].id, each.value.name_suffix, each.value.az_abbreviation]))
+    }
+  )
+
+  lifecycle {
+    # Ignore tags added by kops or kubernetes
+    ignore_changes = [tags.kubernetes, tags.SubnetType]
+  }
+
+  timeouts {
+    create = var.subnet_create_timeout
+    delete = var.subnet_delete_timeout
+  }
+}
+
+resource "aws_route_table" "tier" {
+  # One route table per subnet
+  for_each = local.additional_tier_subnets
+
+  vpc_id = local.vpc_id
+
+  tags = merge(
+    module.tier_label[each.value.tier].tags,
+    {
+      "Name" = join(local.delimiter, compact([module.tier_label[each.value.tier].id, each.value.name_suffix, each.value.az_abbreviation]))
+    }
+  )
+}
+
+resource "aws_route_table_association" "tier" {
+  for_each = local.additional_tier_subnets
+
+  subnet_id      = aws_subnet.tier[each.key].id
+  route_table_id = aws_route_table.tier[each.key].id
+}
+
+resource "aws_route" "tier_igw4" {
+  for_each = local.igw_configured ? { for k, v in local.additional_tier_subnets : k => v if v.egress == "igw" && v.ipv4_enabled } : {}
+
+  route_table_id         = aws_route_table.tier[each.key].id
+  destination_cidr_block = "0.0.0.0/0"
+  gateway_id             = var.igw_id[0]
+
+  timeouts {
+    create = local.route_create_timeout
+    delete = local.route_delete_timeout
+  }
+}
+
+resource "aws_route" "tier_igw6" {
+  for_each = local.igw_configured ? { for k, v in local.additional_tier_subnets : k => v if v.egress == "igw" && v.ipv6_enabled } : {}
+
+  route_table_id              = aws_route_table.tier[each.key].id
+  destination_ipv6_cidr_block = "::/0"
+  gateway_id                  = var.igw_id[0]
+
+  timeouts {
+    create = local.route_create_timeout
+    delete = local.route_delete_timeout
+  }
+}
+
+resource "aws_route" "tier_egress_only6" {
+  for_each = local.private_egress_only6_enabled ? { for k, v in local.additional_tier_subnets : k => v if v.egress == "nat" && v.ipv6_enabled } : {}
+
+  route_table_id              = aws_route_table.tier[each.key].id
+  destination_ipv6_cidr_block = "::/0"
+  egress_only_gateway_id      = var.ipv6_egress_only_igw_id[0]
+
+  timeouts {
+    create = local.route_create_timeout
+    delete = local.route_delete_timeout
+  }
+}
+
+resource "aws_route" "tier_nat4" {
+  for_each = local.nat_gateway4_enabled ? { for k, v in local.additional_tier_subnets : k => v if v.egress == "nat" && v.ipv4_enabled } : {}
+
+  route_table_id         = aws_route_table.tier[each.key].id
+  nat_gateway_id         = aws_nat_gateway.default[each.value.nat_key].id
+  destination_cidr_block = "0.0.0.0/0"
+
+  timeouts {
+    create = local.route_create_timeout
+    delete = local.route_delete_timeout
+  }
+}
+
+resource "aws_route" "tier_nat_instance" {
+  for_each = local.nat_instance_standalone_enabled ? { for k, v in local.additional_tier_subnets : k => v if v.egress == "nat" && v.ipv4_enabled } : {}
+
+  route_table_id         = aws_route_table.tier[each.key].id
+  network_interface_id   = aws_instance.nat_instance[each.value.nat_key].primary_network_interface_id
+  destination_cidr_block = "0.0.0.0/0"
+
+  timeouts {
+    create = local.route_create_timeout
+    delete = local.route_delete_timeout
+  }
+}
+
+resource "aws_route" "tier_nat_instance_nat64" {
+  for_each = local.nat_instance_standalone_enabled ? local.tier_nat_instance_nat64_subnets : {}
+
+  route_table_id              = aws_route_table.tier[each.key].id
+  network_interface_id        = aws_instance.nat_instance[each.value.nat_key].primary_network_interface_id
+  destination_ipv6_cidr_block = local.nat64_cidr
+
+  timeouts {
+    create = local.route_create_timeout
+    delete = local.route_delete_timeout
+  }
+}
+
+resource "aws_route" "tier_nat64" {
+  for_each = local.nat_gateway_enabled ? { for k, v in local.additional_tier_subnets : k => v if v.dns64_enabled && (v.egress == "igw" || local.private_nat64_nat_gateway_enabled) } : {}
+
+  route_table_id              = aws_route_table.tier[each.key].id
+  nat_gateway_id              = aws_nat_gateway.default[each.value.nat_key].id
+  destination_ipv6_cidr_block = local.nat64_cidr
+
+  timeouts {
+    create = local.route_create_timeout
+    delete = local.route_delete_timeout
+  }
+}
+
+resource "aws_network_acl" "tier" {
+  for_each = local.additional_network_acl_tiers
+
+  vpc_id = local.vpc_id
+  subnet_ids = [
+    for s in local.additional_tier_subnet_list : aws_subnet.tier[s.key].id
+    if s.tier == each.key && !contains(local.named_network_acl_subnet_keys[each.key], trimprefix(s.key, format("%s/", each.key)))
+  ]
+
+  tags = module.tier_label[each.key].tags
+}
+
+resource "aws_network_acl_rule" "tier4_ingress" {
+  for_each = local.ipv4_enabled ? { for k, v in local.additional_open_network_acl_tiers : k => v if v.ipv4_enabled } : {}
+
+  network_acl_id = aws_network_acl.tier[each.key].id
+  rule_action    = "allow"
+  rule_number    = var.open_network_acl_ipv4_rule_number
+
+  egress     = false
+  cidr_block = "0.0.0.0/0" #tfsec:ignore:aws-ec2-no-public-ingress-acl
+  from_port  = 0
+  to_port    = 0
+  protocol   = "-1" #tfsec:ignore:aws-ec2-no-excessive-port-access
+}
+
+resource "aws_network_acl_rule" "tier4_egress" {
+  for_each = local.ipv4_enabled ? { for k, v in local.additional_open_network_acl_tiers : k => v if v.ipv4_enabled } : {}
+
+  network_acl_id = aws_network_acl.tier[each.key].id
+  rule_action    = "allow"
+  rule_number    = var.open_network_acl_ipv4_rule_number
+
+  egress     = true
+  cidr_block = "0.0.0.0/0"
+  from_port  = 0
+  to_port    = 0
+  protocol   = "-1" #tfsec:ignore:aws-ec2-no-excessive-port-access
+}
+
+resource "aws_network_acl_rule" "tier6_ingress" {
+  for_each = local.ipv6_enabled ? { for k, v in local.additional_open_network_acl_tiers : k => v if v.ipv6_enabled } : {}
+
+  network_acl_id = aws_network_acl.tier[each.key].id
+  rule_action    = "allow"
+  rule_number    = var.open_network_acl_ipv6_rule_number
+
+  egress          = false
+  ipv6_cidr_block = "::/0" #tfsec:ignore:aws-ec2-no-public-ingress-acl
+  from_port       = 0
+  to_port         = 0
+  protocol        = "-1" #tfsec:ignore:aws-ec2-no-excessive-port-access
+}
+
+resource "aws_network_acl_rule" "tier6_egress" {
+  for_each = local.ipv6_enabled ? { for k, v in local.additional_open_network_acl_tiers : k => v if v.ipv6_enabled } : {}
+
+  network_acl_id = aws_network_acl.tier[each.key].id
+  rule_action    = "allow"
+  rule_number    = var.open_network_acl_ipv6_rule_number
+
+  egress          = true
+  ipv6_cidr_block = "::/0" #tfsec:ignore:aws-ec2-no-excessive-port-access
+  from_port       = 0
+  to_port         = 0
+  protocol        = "-1" #tfsec:ignore:aws-ec2-no-excessive-port-access
+}
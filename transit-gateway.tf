@@ -0,0 +1,63 @@
+module "transit_gateway_label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+
+  attributes = ["tgw"]
+
+  context = module.this.context
+}
+
+resource "aws_ec2_transit_gateway_vpc_attachment" "default" {
+  count = local.transit_gateway_attachment_enabled ? 1 : 0
+
+  transit_gateway_id = var.transit_gateway_id[0]
+  vpc_id             = local.vpc_id
+  subnet_ids         = local.transit_gateway_attachment_subnet_ids
+
+  dns_support            = var.transit_gateway_attachment.dns_support ? "enable" : "disable"
+  ipv6_support           = local.transit_gateway_attachment_ipv6_support ? "enable" : "disable"
+  appliance_mode_support = var.transit_gateway_attachment.appliance_mode_support ? "enable" : "disable"
+
+  transit_gateway_default_route_table_association = var.transit_gateway_attachment.default_route_table_association
+  transit_gateway_default_route_table_propagation = var.transit_gateway_attachment.default_route_table_propagation
+
+  tags = module.transit_gateway_label.tags
+
+  lifecycle {
+    precondition {
+      condition     = local.transit_gateway_attachment_subnets_valid
+      error_message = "The Transit Gateway attachment needs a subnet named `${local.transit_gateway_attachment_subnet_name}` in every AZ in the `${local.transit_gateway_attachment_subnet_tier}` tier. Set `transit_gateway_attachment.subnet_tier` to a tier that creates subnets, and `subnet_name` to one of its subnet names."
+    }
+  }
+}
+
+# Routes to the Transit Gateway in the route tables of the tiers listed in `transit_gateway_routes`,
+# plus the default routes of the NAT egress tiers when `centralized_egress` is enabled
+resource "aws_route" "transit_gateway" {
+  for_each = local.transit_gateway_routes
+
+  route_table_id              = try(local.tier_route_table_id_map[each.value.tier][each.value.route_table_key], "")
+  destination_cidr_block      = each.value.ipv4_cidr
+  destination_ipv6_cidr_block = each.value.ipv6_cidr
+  destination_prefix_list_id  = each.value.prefix_list_id
+  transit_gateway_id          = try(var.transit_gateway_id[0], null)
+
+  # The VPC must be attached before its route tables can route to the Transit Gateway
+  depends_on = [aws_ec2_transit_gateway_vpc_attachment.default]
+
+  timeouts {
+    create = local.route_create_timeout
+    delete = local.route_delete_timeout
+  }
+
+  lifecycle {
+    precondition {
+      condition     = local.transit_gateway_configured
+      error_message = "`centralized_egress` routes Internet-bound traffic to a Transit Gateway, so `transit_gateway_id` must be set."
+    }
+    precondition {
+      condition     = length(local.transit_gateway_route_invalid_tiers) == 0
+      error_message = "Unknown subnet tiers in `transit_gateway_routes`: ${join(", ", local.transit_gateway_route_invalid_tiers)}. Use `private`, `public`, `intra`, or a key of `subnet_tiers`."
+    }
+  }
+}
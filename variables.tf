@@ -74,6 +74,17 @@ variable "public_subnets_enabled" {
   nullable    = false
 }
 
+variable "intra_subnets_enabled" {
+  type        = bool
+  description = <<-EOT
+    If true, create isolated "intra" subnets, with their own route tables but no routes to the internet
+    (no NAT, NAT64, Internet Gateway, or Egress-only Internet Gateway routes), suitable for databases and other
+    resources that must never reach the internet.
+    EOT
+  default     = false
+  nullable    = false
+}
+
 variable "private_label" {
   type        = string
   description = "The string to use in IDs and elsewhere to identify resources for the private subnets and distinguish them from resources for the public subnets"
@@ -88,6 +99,13 @@ variable "public_label" {
   nullable    = false
 }
 
+variable "intra_label" {
+  type        = string
+  description = "The string to use in IDs and elsewhere to identify resources for the intra subnets and distinguish them from resources for the other subnets"
+  default     = "intra"
+  nullable    = false
+}
+
 variable "ipv4_enabled" {
   type        = bool
   description = "Set `true` to enable IPv4 addresses in the subnets"
@@ -105,7 +123,7 @@ variable "ipv6_enabled" {
 variable "ipv4_cidr_block" {
   type        = list(string)
   description = <<-EOT
-    Base IPv4 CIDR block which will be divided into subnet CIDR blocks (e.g. `10.0.0.0/16`). Ignored if `ipv4_cidrs` is set.
+    Base IPv4 CIDR block which will be divided into subnet CIDR blocks (e.g. `10.0.0.0/16`). Ignored if `ipv4_cidrs` or `ipv4_ipam_pool_id` is set.
     If no CIDR block is provided, the VPC's default IPv4 CIDR block will be used.
     EOT
   default     = []
@@ -120,7 +138,7 @@ variable "ipv6_cidr_block" {
   type        = list(string)
   description = <<-EOT
     Base IPv6 CIDR block from which `/64` subnet CIDRs will be assigned. Must be `/56`. (e.g. `2600:1f16:c52:ab00::/56`).
-    Ignored if `ipv6_cidrs` is set. If no CIDR block is provided, the VPC's default IPv6 CIDR block will be used.
+    Ignored if `ipv6_cidrs` or `ipv6_ipam_pool_id` is set. If no CIDR block is provided, the VPC's default IPv6 CIDR block will be used.
     EOT
   default     = []
   nullable    = false
@@ -134,10 +152,12 @@ variable "ipv4_cidrs" {
   type = list(object({
     private = list(string)
     public  = list(string)
+    intra   = optional(list(string), [])
   }))
   description = <<-EOT
     Lists of CIDRs to assign to subnets. Order of CIDRs in the lists must not change over time.
     Lists may contain more CIDRs than needed.
+    The `intra` list is only used when `intra_subnets_enabled` is `true`.
     EOT
   default     = []
   nullable    = false
@@ -151,10 +171,12 @@ variable "ipv6_cidrs" {
   type = list(object({
     private = list(string)
     public  = list(string)
+    intra   = optional(list(string), [])
   }))
   description = <<-EOT
     Lists of CIDRs to assign to subnets. Order of CIDRs in the lists must not change over time.
     Lists may contain more CIDRs than needed.
+    The `intra` list is only used when `intra_subnets_enabled` is `true`.
     EOT
   default     = []
   nullable    = false
@@ -164,6 +186,85 @@ variable "ipv6_cidrs" {
   }
 }
 
+variable "ipv4_ipam_pool_id" {
+  type        = list(string)
+  description = <<-EOT
+    List optionally containing the ID of an AWS IPAM pool from which to allocate the IPv4 CIDR of every subnet,
+    instead of dividing up `ipv4_cidr_block`. The pool must provide addresses within the VPC's CIDRs,
+    e.g. a pool whose source resource is the VPC. Ignored if `ipv4_cidrs` is set.
+    EOT
+  default     = []
+  nullable    = false
+  validation {
+    condition     = length(var.ipv4_ipam_pool_id) < 2
+    error_message = "Only 1 ipv4_ipam_pool_id can be provided."
+  }
+}
+
+variable "ipv4_ipam_netmask_length" {
+  type        = number
+  description = <<-EOT
+    The netmask length of the IPv4 CIDRs allocated from `ipv4_ipam_pool_id`.
+    Subnets with a `host_count` size (see `private_subnets_per_az_sizes`) get a netmask length just large enough for that many hosts instead.
+    Sizes given as `newbits` cannot be used with IPAM, since they are relative to a base CIDR block, and fail the plan.
+    EOT
+  default     = 24
+  nullable    = false
+  validation {
+    condition     = var.ipv4_ipam_netmask_length >= 16 && var.ipv4_ipam_netmask_length <= 28
+    error_message = "The `ipv4_ipam_netmask_length` must be between 16 and 28, the subnet sizes AWS allows."
+  }
+}
+
+variable "ipv6_ipam_pool_id" {
+  type        = list(string)
+  description = <<-EOT
+    List optionally containing the ID of an AWS IPAM pool from which to allocate the IPv6 CIDR of every subnet,
+    instead of dividing up `ipv6_cidr_block`. The pool must provide addresses within the VPC's IPv6 CIDRs.
+    Ignored if `ipv6_cidrs` is set.
+    EOT
+  default     = []
+  nullable    = false
+  validation {
+    condition     = length(var.ipv6_ipam_pool_id) < 2
+    error_message = "Only 1 ipv6_ipam_pool_id can be provided."
+  }
+}
+
+variable "ipv6_ipam_netmask_length" {
+  type        = number
+  description = "The netmask length of the IPv6 CIDRs allocated from `ipv6_ipam_pool_id`"
+  default     = 64
+  nullable    = false
+}
+
+variable "cidr_grid" {
+  type = object({
+    enabled      = optional(bool, false)
+    tier_slots   = optional(number, 4)
+    az_slots     = optional(number, 8)
+    subnet_slots = optional(number, 4)
+  })
+  description = <<-EOT
+    Pin every computed subnet CIDR to a fixed cell in a grid, so that adding or removing an Availability Zone, appending
+    a subnet name, or changing `max_subnet_count` keeps the CIDRs of the other subnets, which are keyed by AZ and name and
+    therefore left untouched. Inserting, removing or reordering names before the last one still moves the subnets of the
+    names after it, since a name's cell follows its position. When `enabled`, each CIDR block is divided into
+    `tier_slots * az_slots * subnet_slots` equal cells (at most 256, so that IPv6 `/64`s fit in a `/56`), and each subnet
+    gets the cell for its tier (by its `grid_slot`: 0 for `private`, 1 for `public`, 2 for `intra`, and the `grid_slot`
+    set in `subnet_tiers` for the additional tiers),
+    its AZ (by the letter at the end of the AZ name, `a` being 0), and its position in the tier's list of subnet names.
+    Subnet sizes (`newbits` or `host_count`) can only make a subnet smaller than its cell. Ignored when CIDRs are
+    supplied or allocated from IPAM. Enabling or resizing the grid changes the CIDRs of existing subnets.
+    EOT
+  default     = {}
+  nullable    = false
+  validation {
+    condition     = var.cidr_grid.tier_slots > 0 && var.cidr_grid.az_slots > 0 && var.cidr_grid.subnet_slots > 0 && var.cidr_grid.tier_slots * var.cidr_grid.az_slots * var.cidr_grid.subnet_slots <= 256
+    error_message = "The `tier_slots`, `az_slots`, and `subnet_slots` of `cidr_grid` must be greater than 0, and their product must not exceed 256."
+  }
+}
+
 variable "availability_zones" {
   type        = list(string)
   description = <<-EOT
@@ -223,6 +324,24 @@ variable "nat_elastic_ips" {
   nullable    = false
 }
 
+variable "nat_gateway_secondary_eip_count" {
+  type        = number
+  description = <<-EOT
+    The number of secondary Elastic IPs to associate with each NAT Gateway, in addition to its primary one.
+    Each Elastic IP gives a NAT Gateway about 55,000 more simultaneous connections to each destination,
+    which helps when NAT Gateways report `ErrorPortAllocation`.
+    If `nat_elastic_ips` is set, it must list the primary Elastic IP of every NAT Gateway,
+    followed by the secondary Elastic IPs of every NAT Gateway, grouped by NAT Gateway.
+    Note that the number of Elastic IPs per NAT Gateway is limited by an AWS quota.
+    EOT
+  default     = 0
+  nullable    = false
+  validation {
+    condition     = var.nat_gateway_secondary_eip_count >= 0 && floor(var.nat_gateway_secondary_eip_count) == var.nat_gateway_secondary_eip_count
+    error_message = "The `nat_gateway_secondary_eip_count` must be a whole number, 0 or more."
+  }
+}
+
 variable "nat_gateway_public_subnet_indices" {
   type        = list(number)
   description = <<-EOT
@@ -257,6 +376,46 @@ variable "nat_gateway_public_subnet_names" {
   nullable    = true
 }
 
+variable "private_nat_gateway" {
+  type = object({
+    enabled                            = optional(bool, false)
+    subnet_name                        = optional(string)
+    subnet_tiers                       = optional(list(string), [])
+    destination_cidrs                  = optional(list(string), [])
+    destination_prefix_list_ids        = optional(list(string), [])
+    secondary_private_ip_address_count = optional(number, 0)
+  })
+  description = <<-EOT
+    Configuration of private NAT Gateways (`connectivity_type = "private"`), which let subnets whose CIDRs
+    are not routable outside the VPC, such as overlapping CIDRs, reach other private networks, e.g. on-premises via a Transit Gateway.
+      - `enabled`: Set `true` to create a private NAT Gateway in each AZ, up to `max_nats`.
+      - `subnet_name`: The name, from `private_subnets_per_az_names`, of the private subnets to place the NAT Gateways in.
+        These need routable CIDRs and routes to the destinations, e.g. via `transit_gateway_routes`. Defaults to the first private subnet name.
+      - `subnet_tiers`: The subnet tiers (other than `public`) whose route tables route the destinations to the NAT Gateways.
+        Each route table routes to the NAT Gateway in its own AZ, or wraps around when `max_nats` limits the NAT Gateways to fewer AZs.
+        When `private` is listed, the route tables of the `subnet_name` subnets are left out, since their routes would loop back to the NAT Gateways.
+      - `destination_cidrs` and `destination_prefix_list_ids`: The IPv4 destinations to route to the NAT Gateways.
+        Private NAT Gateways cannot reach the internet, so `destination_cidrs` must not include a default route.
+      - `secondary_private_ip_address_count`: The number of secondary private IPs to assign to each NAT Gateway,
+        from 0 to 31, to mitigate port exhaustion. Only private NAT Gateways support this; public ones use `nat_gateway_secondary_eip_count`.
+    EOT
+  default     = {}
+  nullable    = false
+  validation {
+    condition = alltrue([
+      for c in var.private_nat_gateway.destination_cidrs : can(cidrnetmask(c)) && try(tonumber(split("/", c)[1]) > 0, false)
+    ])
+    error_message = "The `destination_cidrs` of `private_nat_gateway` must be IPv4 CIDRs other than the default route `0.0.0.0/0`, since private NAT Gateways cannot reach the internet."
+  }
+  validation {
+    condition = (
+      var.private_nat_gateway.secondary_private_ip_address_count >= 0 && var.private_nat_gateway.secondary_private_ip_address_count <= 31 &&
+      floor(var.private_nat_gateway.secondary_private_ip_address_count) == var.private_nat_gateway.secondary_private_ip_address_count
+    )
+    error_message = "The `secondary_private_ip_address_count` of `private_nat_gateway` must be a whole number from 0 to 31, the most secondary private IPs AWS allows on a NAT Gateway."
+  }
+}
+
 variable "map_public_ip_on_launch" {
   type        = bool
   description = "If `true`, instances launched into a public subnet will be assigned a public IPv4 address"
@@ -282,9 +441,12 @@ variable "private_dns64_nat64_enabled" {
   type        = bool
   description = <<-EOT
     If `true` and IPv6 is enabled, DNS queries made to the Amazon-provided DNS Resolver in private subnets will return synthetic
-    IPv6 addresses for IPv4-only destinations, and these addresses will be routed to the NAT Gateway.
-    Requires `public_subnets_enabled`, `nat_gateway_enabled`, and `private_route_table_enabled` to be `true` to be fully operational.
+    IPv6 addresses for IPv4-only destinations, and these addresses will be routed to the NAT Gateway,
+    or to the NAT instance when `nat_instance_nat64_enabled` is `true`.
+    Requires `public_subnets_enabled`, `nat_gateway_enabled` (or `nat_instance_nat64_enabled`), and `private_route_table_enabled`
+    to be `true` to be fully operational.
     Defaults to `true` unless there is no public IPv4 subnet for egress, in which case it defaults to `false`.
+    With `centralized_egress` enabled, it defaults to `true` unless `centralized_egress.nat64` rules out NAT64.
     EOT
   default     = null
 }
@@ -359,8 +521,8 @@ variable "private_open_network_acl_enabled" {
   description = <<-EOT
     If `true`, a single network ACL be created and it will be associated with every private subnet, and a rule (number 100)
     will be created allowing all ingress and all egress. You can add additional rules to this network ACL
-    using the `aws_network_acl_rule` resource.
-    If `false`, you will need to manage the network ACL outside of this module.
+    using `network_acl_rules` or the `aws_network_acl_rule` resource.
+    If `false`, you will need to manage the network ACL outside of this module, unless the tier is listed in `network_acl_rules`.
     EOT
   default     = true
   nullable    = false
@@ -371,8 +533,20 @@ variable "public_open_network_acl_enabled" {
   description = <<-EOT
     If `true`, a single network ACL be created and it will be associated with every public subnet, and a rule
     will be created allowing all ingress and all egress. You can add additional rules to this network ACL
-    using the `aws_network_acl_rule` resource.
-    If `false`, you will need to manage the network ACL outside of this module.
+    using `network_acl_rules` or the `aws_network_acl_rule` resource.
+    If `false`, you will need to manage the network ACL outside of this module, unless the tier is listed in `network_acl_rules`.
+    EOT
+  default     = true
+  nullable    = false
+}
+
+variable "intra_open_network_acl_enabled" {
+  type        = bool
+  description = <<-EOT
+    If `true`, a single network ACL be created and it will be associated with every intra subnet, and a rule
+    will be created allowing all ingress and all egress. You can add additional rules to this network ACL
+    using `network_acl_rules` or the `aws_network_acl_rule` resource.
+    If `false`, you will need to manage the network ACL outside of this module, unless the tier is listed in `network_acl_rules`.
     EOT
   default     = true
   nullable    = false
@@ -392,6 +566,191 @@ variable "open_network_acl_ipv6_rule_number" {
   nullable    = false
 }
 
+variable "network_acl_rules" {
+  type = map(object({
+    ingress = optional(list(object({
+      rule_number     = number
+      rule_action     = optional(string, "allow")
+      protocol        = optional(string, "-1")
+      from_port       = optional(number, 0)
+      to_port         = optional(number, 0)
+      cidr_block      = optional(string)
+      ipv6_cidr_block = optional(string)
+      icmp_type       = optional(number)
+      icmp_code       = optional(number)
+    })), [])
+    egress = optional(list(object({
+      rule_number     = number
+      rule_action     = optional(string, "allow")
+      protocol        = optional(string, "-1")
+      from_port       = optional(number, 0)
+      to_port         = optional(number, 0)
+      cidr_block      = optional(string)
+      ipv6_cidr_block = optional(string)
+      icmp_type       = optional(number)
+      icmp_code       = optional(number)
+    })), [])
+    preset             = optional(string)
+    trusted_ipv4_cidrs = optional(list(string), [])
+    trusted_ipv6_cidrs = optional(list(string), [])
+  }))
+  description = <<-EOT
+    Network ACL rules to manage in the network ACL of a subnet tier, keyed by tier (`private`, `public`, `intra`, or an additional tier).
+    Listing a tier here creates its network ACL even if its `open_network_acl_enabled` is `false`, in which case
+    only the listed rules are created. Otherwise, the rules are added to the open rules, which they override if their `rule_number` is lower.
+    Each rule takes the arguments of the `aws_network_acl_rule` resource: `rule_number`, `rule_action` (`allow` or `deny`,
+    default `allow`), `protocol` (default `-1`, meaning all), `from_port` and `to_port` (default `0`), exactly one of
+    `cidr_block` and `ipv6_cidr_block`, and, for ICMP, `icmp_type` and `icmp_code`.
+    Rule numbers must be unique within each direction of a tier, and must not be the open rule numbers
+    (`open_network_acl_ipv4_rule_number` and `open_network_acl_ipv6_rule_number`) when the open rules are created.
+    Instead of, or in addition to, listing rules, set `preset` to generate a set of rules:
+    - `open`: allow all traffic
+    - `deny-admin-ports`: deny SSH (22) and RDP (3389) from untrusted sources, and allow all other traffic
+    - `hardened-public`: allow all traffic from trusted sources, and only HTTP (80), HTTPS (443),
+      ephemeral ports (1024-65535) and ICMP Path MTU Discovery messages from elsewhere
+    - `hardened-private`: allow all traffic from trusted sources, and only ephemeral ports (1024-65535), for return traffic,
+      and ICMP Path MTU Discovery messages from elsewhere
+    All presets allow all outbound traffic. The trusted sources are the CIDR blocks of the module's subnets
+    (the VPC CIDR blocks they are in, when known) plus `trusted_ipv4_cidrs` and `trusted_ipv6_cidrs`, such as a VPN
+    or the VPC of another region. Preset rules are numbered from 1000 up, so listed rules with lower numbers take precedence,
+    and a listed rule with the number of a preset rule replaces it. A tier with a preset does not get the open rules.
+    The trusted sources are numbered from 1000 to 1099, so a preset trusts at most 100 of them.
+    EOT
+  default     = {}
+  nullable    = false
+  validation {
+    condition = alltrue(flatten([
+      for v in values(var.network_acl_rules) : [
+        for r in concat(v.ingress, v.egress) : (r.cidr_block == null) != (r.ipv6_cidr_block == null) &&
+        contains(["allow", "deny"], r.rule_action) && r.rule_number >= 1 && r.rule_number <= 32766
+      ]
+    ]))
+    error_message = "Each of `network_acl_rules` must have exactly one of `cidr_block` and `ipv6_cidr_block`, a `rule_action` of `allow` or `deny`, and a `rule_number` from 1 to 32766."
+  }
+  validation {
+    condition = alltrue(flatten([
+      for v in values(var.network_acl_rules) : [
+        length(distinct(v.ingress[*].rule_number)) == length(v.ingress),
+        length(distinct(v.egress[*].rule_number)) == length(v.egress),
+      ]
+    ]))
+    error_message = "The `rule_number` of each of `network_acl_rules` must be unique within the ingress or egress rules of its tier."
+  }
+  validation {
+    condition = alltrue([
+      for v in values(var.network_acl_rules) : v.preset == null ? true : contains(["open", "deny-admin-ports", "hardened-public", "hardened-private"], v.preset)
+    ])
+    error_message = "The `preset` of each of `network_acl_rules` must be one of `open`, `deny-admin-ports`, `hardened-public` and `hardened-private`."
+  }
+}
+
+variable "named_network_acl_rules" {
+  type = map(map(object({
+    ingress = optional(list(object({
+      rule_number     = number
+      rule_action     = optional(string, "allow")
+      protocol        = optional(string, "-1")
+      from_port       = optional(number, 0)
+      to_port         = optional(number, 0)
+      cidr_block      = optional(string)
+      ipv6_cidr_block = optional(string)
+      icmp_type       = optional(number)
+      icmp_code       = optional(number)
+    })), [])
+    egress = optional(list(object({
+      rule_number     = number
+      rule_action     = optional(string, "allow")
+      protocol        = optional(string, "-1")
+      from_port       = optional(number, 0)
+      to_port         = optional(number, 0)
+      cidr_block      = optional(string)
+      ipv6_cidr_block = optional(string)
+      icmp_type       = optional(number)
+      icmp_code       = optional(number)
+    })), [])
+    preset             = optional(string)
+    trusted_ipv4_cidrs = optional(list(string), [])
+    trusted_ipv6_cidrs = optional(list(string), [])
+  })))
+  description = <<-EOT
+    Network ACLs to create for subnets with a given name, separate from the network ACL of their tier,
+    as a map of tier (`private`, `public`, `intra`, or an additional tier) to a map of subnet name
+    (from the tier's `subnets_per_az_names`) to the rules of the network ACL for those subnets.
+    The rules, including any `preset`, are configured as in `network_acl_rules`, and are the only rules in the network ACL:
+    no open rules are added.
+    For example, `{ private = { database = { ingress = [...], egress = [...] } } }` gives the private `database` subnets
+    in every AZ their own network ACL, and leaves the other private subnets in the private network ACL.
+    EOT
+  default     = {}
+  nullable    = false
+  validation {
+    condition = alltrue(flatten([
+      for names in values(var.named_network_acl_rules) : [
+        for v in values(names) : [
+          for r in concat(v.ingress, v.egress) : (r.cidr_block == null) != (r.ipv6_cidr_block == null) &&
+          contains(["allow", "deny"], r.rule_action) && r.rule_number >= 1 && r.rule_number <= 32766
+        ]
+      ]
+    ]))
+    error_message = "Each of `named_network_acl_rules` must have exactly one of `cidr_block` and `ipv6_cidr_block`, a `rule_action` of `allow` or `deny`, and a `rule_number` from 1 to 32766."
+  }
+  validation {
+    condition = alltrue(flatten([
+      for names in values(var.named_network_acl_rules) : [
+        for v in values(names) : [
+          length(distinct(v.ingress[*].rule_number)) == length(v.ingress),
+          length(distinct(v.egress[*].rule_number)) == length(v.egress),
+        ]
+      ]
+    ]))
+    error_message = "The `rule_number` of each of `named_network_acl_rules` must be unique within the ingress or egress rules of its network ACL."
+  }
+  validation {
+    condition = alltrue(flatten([
+      for names in values(var.named_network_acl_rules) : [
+        for v in values(names) : v.preset == null ? true : contains(["open", "deny-admin-ports", "hardened-public", "hardened-private"], v.preset)
+      ]
+    ]))
+    error_message = "The `preset` of each of `named_network_acl_rules` must be one of `open`, `deny-admin-ports`, `hardened-public` and `hardened-private`."
+  }
+}
+
+variable "public_network_acl_ids" {
+  type        = list(string)
+  description = <<-EOT
+    List optionally containing the ID of an existing network ACL to associate with all public subnets,
+    or exactly one network ACL ID for each public subnet, in the order of `public_subnet_ids`.
+    If provided, the module does not create a network ACL for the public subnets,
+    and `network_acl_rules` cannot be configured for the `public` tier.
+    EOT
+  default     = []
+  nullable    = false
+}
+
+variable "private_network_acl_ids" {
+  type        = list(string)
+  description = <<-EOT
+    List optionally containing the ID of an existing network ACL to associate with all private subnets,
+    or exactly one network ACL ID for each private subnet, in the order of `private_subnet_ids`.
+    If provided, the module does not create a network ACL for the private subnets,
+    and `network_acl_rules` cannot be configured for the `private` tier.
+    EOT
+  default     = []
+  nullable    = false
+}
+
+variable "named_network_acl_ids" {
+  type        = map(map(string))
+  description = <<-EOT
+    Existing network ACLs to associate with subnets with a given name, as a map of tier (`private`, `public`, `intra`,
+    or an additional tier) to a map of subnet name (from the tier's `subnets_per_az_names`) to network ACL ID.
+    The subnets with that name in every AZ are associated with the network ACL, and left out of the network ACL of their tier.
+    A subnet name cannot be in both `named_network_acl_ids` and `named_network_acl_rules`.
+    EOT
+  default     = {}
+  nullable    = false
+}
+
 variable "private_route_table_enabled" {
   type        = bool
   description = <<-EOT
@@ -480,6 +839,13 @@ variable "public_subnets_additional_tags" {
   nullable    = false
 }
 
+variable "intra_subnets_additional_tags" {
+  type        = map(string)
+  description = "Additional tags to be added to intra subnets"
+  default     = {}
+  nullable    = false
+}
+
 variable "subnets_per_az_count" {
   type        = number
   description = <<-EOT
@@ -560,22 +926,462 @@ variable "private_subnets_per_az_names" {
   nullable    = true
 }
 
+variable "intra_subnets_per_az_count" {
+  type        = number
+  description = <<-EOT
+    The number of intra subnets to provision per Availability Zone.
+    If not provided, defaults to the value of `subnets_per_az_count`.
+    EOT
+  default     = null
+  validation {
+    condition     = var.intra_subnets_per_az_count == null ? true : var.intra_subnets_per_az_count > 0
+    error_message = "The `intra_subnets_per_az_count` value must be greater than 0 or null."
+  }
+}
+
+variable "intra_subnets_per_az_names" {
+  type        = list(string)
+  description = <<-EOT
+    The names to assign to the intra subnets per Availability Zone.
+    If not provided, defaults to the value of `subnets_per_az_names`.
+    If provided, the length must match `intra_subnets_per_az_count`.
+    The names will be used as keys in the outputs `named_intra_subnets_map` and `named_intra_route_table_ids_map`.
+    EOT
+  default     = null
+  nullable    = true
+}
+
+variable "public_subnets_per_az_sizes" {
+  type = map(object({
+    newbits    = optional(number)
+    host_count = optional(number)
+  }))
+  description = <<-EOT
+    Map of public subnet name (as given in `public_subnets_per_az_names`) to the size of the IPv4 CIDR for subnets with that name,
+    allowing subnets of different sizes. Set exactly one of:
+      - `newbits`: the number of bits to add to the prefix length of the CIDR block the subnet is placed in (usually `ipv4_cidr_block`), as in `cidrsubnet`
+      - `host_count`: the minimum number of usable host addresses (not counting the 5 addresses AWS reserves in every subnet)
+    Subnets not in the map get the same size they would get if this map were empty.
+    Ignored when CIDRs are supplied via `ipv4_cidrs`. See the README for how subnets of different sizes are laid out.
+    EOT
+  default     = {}
+  nullable    = false
+  validation {
+    condition = alltrue([
+      for v in values(var.public_subnets_per_az_sizes) : (v.newbits == null) != (v.host_count == null)
+    ])
+    error_message = "Each entry in `public_subnets_per_az_sizes` must set exactly one of `newbits` or `host_count`."
+  }
+  validation {
+    condition = alltrue([
+      for v in values(var.public_subnets_per_az_sizes) : coalesce(v.newbits, v.host_count, 1) > 0
+    ])
+    error_message = "The `newbits` and `host_count` values in `public_subnets_per_az_sizes` must be greater than 0."
+  }
+}
+
+variable "private_subnets_per_az_sizes" {
+  type = map(object({
+    newbits    = optional(number)
+    host_count = optional(number)
+  }))
+  description = <<-EOT
+    Map of private subnet name (as given in `private_subnets_per_az_names`) to the size of the IPv4 CIDR for subnets with that name,
+    allowing subnets of different sizes. Set exactly one of:
+      - `newbits`: the number of bits to add to the prefix length of the CIDR block the subnet is placed in (usually `ipv4_cidr_block`), as in `cidrsubnet`
+      - `host_count`: the minimum number of usable host addresses (not counting the 5 addresses AWS reserves in every subnet)
+    Subnets not in the map get the same size they would get if this map were empty.
+    Ignored when CIDRs are supplied via `ipv4_cidrs`. See the README for how subnets of different sizes are laid out.
+    EOT
+  default     = {}
+  nullable    = false
+  validation {
+    condition = alltrue([
+      for v in values(var.private_subnets_per_az_sizes) : (v.newbits == null) != (v.host_count == null)
+    ])
+    error_message = "Each entry in `private_subnets_per_az_sizes` must set exactly one of `newbits` or `host_count`."
+  }
+  validation {
+    condition = alltrue([
+      for v in values(var.private_subnets_per_az_sizes) : coalesce(v.newbits, v.host_count, 1) > 0
+    ])
+    error_message = "The `newbits` and `host_count` values in `private_subnets_per_az_sizes` must be greater than 0."
+  }
+}
+
+variable "subnet_tiers" {
+  type = map(object({
+    enabled                  = optional(bool)
+    egress                   = optional(string)
+    subnets_per_az_count     = optional(number)
+    subnets_per_az_names     = optional(list(string))
+    ipv4_enabled             = optional(bool)
+    ipv6_enabled             = optional(bool)
+    ipv4_cidrs               = optional(list(string))
+    ipv6_cidrs               = optional(list(string))
+    label                    = optional(string)
+    additional_tags          = optional(map(string))
+    open_network_acl_enabled = optional(bool)
+    subnets_per_az_sizes = optional(map(object({
+      newbits    = optional(number)
+      host_count = optional(number)
+    })))
+    ipv4_cidr_block         = optional(string)
+    subnet_ipv4_cidr_blocks = optional(map(string))
+    grid_slot               = optional(number)
+  }))
+  description = <<-EOT
+    Map of subnet tiers to provision in each Availability Zone, keyed by tier name (e.g. `app`, `data`).
+    The keys `public`, `private`, and `intra` refer to the built-in tiers, which are otherwise configured by the
+    `public_*`, `private_*`, and `intra_*` inputs. Attributes set here override those inputs, and attributes left `null` fall back to them.
+    `enabled` defaults to `true` for additional tiers, and to `public_subnets_enabled`, `private_subnets_enabled`,
+    and `intra_subnets_enabled` for the built-in tiers.
+    Every other key creates an additional tier with its own subnets, route tables, and network ACL.
+    `egress` is one of:
+      - `igw`: route `0.0.0.0/0` and `::/0` to the Internet Gateway in `igw_id`
+      - `nat`: route `0.0.0.0/0` to the NAT Gateway or NAT Instance in the same AZ (if any), and `::/0` to the Egress-only Internet Gateway in `ipv6_egress_only_igw_id`
+      - `none`: no routes to the internet at all
+    `egress` is required for additional tiers, and cannot be changed for the built-in tiers
+    (`public` is always `igw`, `private` is always `nat`, and `intra` is always `none`).
+    `subnets_per_az_names` defaults to a single subnet named after the tier, or to `subnets_per_az_count` subnets named
+    by their position (`0`, `1`, ...) when that is more than 1. If both are set, the two must agree.
+    `ipv4_enabled` and `ipv6_enabled` default to `ipv4_enabled` and `ipv6_enabled`, `label` defaults to the tier name,
+    and `open_network_acl_enabled` defaults to `true`.
+    `ipv4_cidrs` and `ipv6_cidrs` supply the CIDRs for the tier the same way `ipv4_cidrs` and `ipv6_cidrs` do for the built-in tiers.
+    `subnets_per_az_sizes` sets the IPv4 CIDR size of subnets by name, the same way `private_subnets_per_az_sizes` does.
+    `ipv4_cidr_block` places the computed IPv4 CIDRs of the tier in a secondary CIDR block associated with the VPC
+    instead of the base CIDR block (`ipv4_cidr_block`, or the VPC's primary CIDR block), and `subnet_ipv4_cidr_blocks`
+    does the same for individual subnets, keyed by subnet name. Each CIDR block is divided up separately.
+    `grid_slot` is the tier's slot in the `cidr_grid`, and is required for additional tiers when the grid is enabled.
+    The built-in tiers have the fixed slots 0 (`private`), 1 (`public`), and 2 (`intra`), so additional tiers use
+    slots from 3 up, each a different one. Unlike their position among the tiers, it does not change when tiers are added or removed.
+    Computed CIDRs are reserved for `private` and `public` first, and then for `intra` and the additional tiers in
+    alphabetical order, in the space left over, so adding a tier never changes the CIDRs of the `private` and `public`
+    subnets, and adding one whose name sorts after the existing ones changes no CIDRs at all. The plan fails when the
+    tiers do not fit in that space, in which case give them smaller `subnets_per_az_sizes` or their own `ipv4_cidr_block`.
+    EOT
+  default     = {}
+  nullable    = false
+  validation {
+    condition = alltrue([
+      for v in values(var.subnet_tiers) : v.egress == null ? true : contains(["igw", "nat", "none"], v.egress)
+    ])
+    error_message = "The `egress` of a subnet tier must be one of `igw`, `nat`, or `none`."
+  }
+  validation {
+    condition = alltrue([
+      for k, v in var.subnet_tiers : contains(["public", "private", "intra"], k) ? (
+        v.egress == null || v.egress == lookup({ public = "igw", private = "nat", intra = "none" }, k)
+      ) : v.egress != null
+    ])
+    error_message = "The `egress` of an additional subnet tier is required. The `egress` of the built-in `public`, `private`, and `intra` tiers cannot be changed."
+  }
+  validation {
+    condition = alltrue([
+      for v in values(var.subnet_tiers) : v.subnets_per_az_count == null ? true : v.subnets_per_az_count > 0
+    ])
+    error_message = "The `subnets_per_az_count` of a subnet tier must be greater than 0 or null."
+  }
+  validation {
+    condition = alltrue(flatten([
+      for v in values(var.subnet_tiers) : [
+        for size in values(coalesce(v.subnets_per_az_sizes, {})) : (size.newbits == null) != (size.host_count == null) && coalesce(size.newbits, size.host_count, 1) > 0
+      ]
+    ]))
+    error_message = "Each entry in the `subnets_per_az_sizes` of a subnet tier must set exactly one of `newbits` or `host_count`, greater than 0."
+  }
+  validation {
+    condition = alltrue(flatten([
+      for v in values(var.subnet_tiers) : [
+        for cidr in concat(v.ipv4_cidr_block == null ? [] : [v.ipv4_cidr_block], values(coalesce(v.subnet_ipv4_cidr_blocks, {}))) : can(cidrnetmask(cidr))
+      ]
+    ]))
+    error_message = "The `ipv4_cidr_block` and `subnet_ipv4_cidr_blocks` of a subnet tier must be IPv4 CIDR blocks."
+  }
+  validation {
+    condition = alltrue([
+      for k, v in var.subnet_tiers : contains(["public", "private", "intra"], k) || v.subnets_per_az_names == null ? true : (
+        length(distinct(v.subnets_per_az_names)) == length(v.subnets_per_az_names) &&
+        (v.subnets_per_az_count == null || length(v.subnets_per_az_names) == v.subnets_per_az_count)
+      )
+    ])
+    error_message = "The `subnets_per_az_names` of an additional subnet tier must be unique, and as many as its `subnets_per_az_count`, if that is set."
+  }
+  validation {
+    condition = alltrue([
+      for k, v in var.subnet_tiers : v.grid_slot == null ? true : !contains(["public", "private", "intra"], k) && v.grid_slot >= 3 && floor(v.grid_slot) == v.grid_slot
+    ])
+    error_message = "The `grid_slot` of an additional subnet tier must be a whole number of at least 3, and cannot be set for the built-in `public`, `private`, and `intra` tiers."
+  }
+  validation {
+    condition = length([for v in values(var.subnet_tiers) : v.grid_slot if v.grid_slot != null]) == length(distinct([
+      for v in values(var.subnet_tiers) : v.grid_slot if v.grid_slot != null
+    ]))
+    error_message = "Each additional subnet tier must have a different `grid_slot`."
+  }
+}
+
+variable "additional_routes" {
+  type = map(object({
+    subnet_tier                 = optional(string, "private")
+    subnet_names                = optional(list(string))
+    destination_cidr_block      = optional(string)
+    destination_ipv6_cidr_block = optional(string)
+    destination_prefix_list_id  = optional(string)
+    vpc_peering_connection_id   = optional(string)
+    gateway_id                  = optional(string)
+    transit_gateway_id          = optional(string)
+    network_interface_id        = optional(string)
+    egress_only_gateway_id      = optional(string)
+    vpc_endpoint_id             = optional(string)
+    carrier_gateway_id          = optional(string)
+  }))
+  description = <<-EOT
+    Routes to add to the route tables created by this module (and to those in `public_route_table_ids`), keyed by a name of your choosing.
+      - `subnet_tier`: The tier (`private`, `public`, `intra`, or an additional tier) whose route tables get the route.
+      - `subnet_names`: If set, only the route tables of the subnets with these names get the route,
+        as in `named_private_route_table_ids_map`. Defaults to every route table of the tier.
+      - `destination_cidr_block`, `destination_ipv6_cidr_block`, or `destination_prefix_list_id`: The destination,
+        exactly one of them. A managed prefix list lets one route cover many CIDRs, such as your on-premises ranges.
+      - The target, exactly one of `vpc_peering_connection_id`, `gateway_id` (a Virtual Private Gateway),
+        `transit_gateway_id`, `network_interface_id`, `egress_only_gateway_id`, `vpc_endpoint_id`
+        (a Gateway Load Balancer endpoint), or `carrier_gateway_id`.
+    The routes are keyed by "<name>/<route table key>" (see `docs/design.md`).
+    EOT
+  default     = {}
+  nullable    = false
+  validation {
+    condition = alltrue([
+      for r in values(var.additional_routes) : length(compact([r.destination_cidr_block, r.destination_ipv6_cidr_block, r.destination_prefix_list_id])) == 1
+    ])
+    error_message = "Each of `additional_routes` must have exactly one of `destination_cidr_block`, `destination_ipv6_cidr_block`, and `destination_prefix_list_id`."
+  }
+  validation {
+    condition = alltrue([
+      for r in values(var.additional_routes) : length(compact([
+        r.vpc_peering_connection_id, r.gateway_id, r.transit_gateway_id, r.network_interface_id,
+        r.egress_only_gateway_id, r.vpc_endpoint_id, r.carrier_gateway_id,
+      ])) == 1
+    ])
+    error_message = "Each of `additional_routes` must have exactly one target."
+  }
+}
+
+#############################################################
+############## Transit Gateway configuration ################
+variable "transit_gateway_id" {
+  type        = list(string)
+  description = <<-EOT
+    The ID of a Transit Gateway to attach the VPC to (unless `transit_gateway_attachment_enabled` is `false`)
+    and to route the destinations in `transit_gateway_routes` to.
+    EOT
+  default     = []
+  nullable    = false
+  validation {
+    condition     = length(var.transit_gateway_id) < 2
+    error_message = "Only 1 transit_gateway_id can be provided."
+  }
+}
+
+variable "transit_gateway_attachment_enabled" {
+  type        = bool
+  description = <<-EOT
+    If `true` and `transit_gateway_id` is set, attach the VPC to the Transit Gateway.
+    Set to `false` when the attachment is managed elsewhere and you only want the routes in `transit_gateway_routes`.
+    EOT
+  default     = true
+  nullable    = false
+}
+
+variable "transit_gateway_attachment" {
+  type = object({
+    subnet_tier                     = optional(string, "private")
+    subnet_name                     = optional(string)
+    dns_support                     = optional(bool, true)
+    ipv6_support                    = optional(bool)
+    appliance_mode_support          = optional(bool, false)
+    default_route_table_association = optional(bool)
+    default_route_table_propagation = optional(bool)
+  })
+  description = <<-EOT
+    Configuration of the Transit Gateway VPC attachment.
+    The attachment uses one subnet per AZ: the subnet named `subnet_name` in the tier `subnet_tier` (any tier,
+    built-in or additional). `subnet_name` defaults to the first subnet name of the tier; a small dedicated subnet
+    is recommended, since the attachment takes an IP address in it and route tables apply to its traffic.
+    `ipv6_support` defaults to whether the tier has IPv6 enabled.
+    `default_route_table_association` and `default_route_table_propagation` are left to the provider default when `null`,
+    and must be `null` when the Transit Gateway is in another account.
+    EOT
+  default     = {}
+  nullable    = false
+}
+
+variable "transit_gateway_routes" {
+  type = map(object({
+    ipv4_cidrs      = optional(list(string), [])
+    ipv6_cidrs      = optional(list(string), [])
+    prefix_list_ids = optional(list(string), [])
+  }))
+  description = <<-EOT
+    Destinations to route to the Transit Gateway in `transit_gateway_id`, keyed by subnet tier (`private`, `public`,
+    `intra`, or an additional tier). A route to each destination is added to every route table the module creates
+    for that tier (route tables supplied via `public_route_table_ids` are not modified).
+    `ipv4_cidrs` and `ipv6_cidrs` are destination CIDR blocks and `prefix_list_ids` are the IDs of managed prefix lists.
+    The destinations are part of the resource keys, so they must be known at plan time.
+    EOT
+  default     = {}
+  nullable    = false
+  validation {
+    condition = alltrue(flatten([
+      for v in values(var.transit_gateway_routes) : concat(
+        [for cidr in v.ipv4_cidrs : can(cidrnetmask(cidr))],
+        [for cidr in v.ipv6_cidrs : can(cidrhost(cidr, 0)) && !can(cidrnetmask(cidr))],
+      )
+    ]))
+    error_message = "The `ipv4_cidrs` and `ipv6_cidrs` of `transit_gateway_routes` must be IPv4 and IPv6 CIDR blocks respectively."
+  }
+}
+
+variable "centralized_egress" {
+  type = object({
+    enabled      = optional(bool, false)
+    ipv6_enabled = optional(bool, false)
+    nat64        = optional(string, "transit_gateway")
+  })
+  description = <<-EOT
+    Configuration for sending Internet-bound traffic to a central egress VPC through the Transit Gateway in `transit_gateway_id`.
+    When `enabled` is `true`, the route tables of the tiers with `egress = "nat"` (including `private`) send `0.0.0.0/0`
+    to the Transit Gateway instead of to a NAT device, and no NAT Gateways, NAT instances or Elastic IPs are created for them.
+      - `ipv6_enabled`: If `true`, `::/0` is also sent to the Transit Gateway. If `false` (the default), IPv6 egress
+        still uses the Egress-only Internet Gateway in `ipv6_egress_only_igw_id`, if any.
+      - `nat64`: Where subnets with DNS64 enabled send the NAT64 prefix (`64:ff9b::/96`).
+        `transit_gateway` (the default) sends it to the Transit Gateway, for NAT64 in the egress VPC.
+        `nat_gateway` keeps NAT Gateways in the public subnets, used only for NAT64.
+        `none` adds no NAT64 route, and DNS64 defaults to disabled.
+    EOT
+  default     = {}
+  nullable    = false
+  validation {
+    condition     = contains(["transit_gateway", "nat_gateway", "none"], var.centralized_egress.nat64)
+    error_message = "`centralized_egress.nat64` must be one of \"transit_gateway\", \"nat_gateway\", or \"none\"."
+  }
+}
+
+#############################################################
+############## VPC endpoint configuration ###################
+variable "gateway_vpc_endpoints" {
+  type = map(object({
+    service_name      = optional(string)
+    policy            = optional(string)
+    route_table_tiers = optional(list(string))
+    subnet_names      = optional(map(list(string)), {})
+    tags              = optional(map(string), {})
+  }))
+  description = <<-EOT
+    Gateway VPC endpoints to create, keyed by service (`s3` or `dynamodb`).
+      - `service_name`: The full service name. Defaults to `com.amazonaws.<region>.<key>`.
+      - `policy`: A JSON policy document for the endpoint. Defaults to the AWS policy allowing full access.
+      - `route_table_tiers`: Subnet tiers (`private`, `public`, `intra`, or an additional tier) whose route tables
+        the endpoint is associated with. Defaults to `["private"]`, or to none when `subnet_names` is set.
+      - `subnet_names`: Map of subnet tier to the subnet names whose route tables the endpoint is associated with,
+        e.g. `{ private = ["app"] }` for the route tables in `named_private_route_table_ids_map["app"]`.
+      - `tags`: Additional tags for the endpoint.
+    Only route tables created by this module are associated.
+    EOT
+  default     = {}
+  nullable    = false
+}
+
+variable "interface_vpc_endpoints" {
+  type = map(object({
+    service_name        = optional(string)
+    policy              = optional(string)
+    private_dns_enabled = optional(bool, true)
+    security_group_ids  = optional(list(string), [])
+    tags                = optional(map(string), {})
+  }))
+  description = <<-EOT
+    Interface VPC endpoints to create, keyed by service (e.g. `ssm`, `ecr.api`, `sts`). Each endpoint is placed in the
+    private subnet named `interface_vpc_endpoint_subnet_name` in every AZ.
+      - `service_name`: The full service name. Defaults to `com.amazonaws.<region>.<key>`.
+      - `policy`: A JSON policy document for the endpoint. Defaults to the AWS policy allowing full access.
+      - `private_dns_enabled`: Whether the service's public DNS name resolves to the endpoint within the VPC.
+      - `security_group_ids`: Security groups to attach in addition to the one configured by `interface_vpc_endpoint_security_group`.
+      - `tags`: Additional tags for the endpoint.
+    EOT
+  default     = {}
+  nullable    = false
+}
+
+variable "interface_vpc_endpoint_subnet_name" {
+  type        = string
+  description = <<-EOT
+    The name, from `private_subnets_per_az_names`, of the private subnets to place the interface VPC endpoints in.
+    Defaults to the first private subnet name. A small dedicated subnet is a common choice.
+    EOT
+  default     = null
+}
+
+variable "interface_vpc_endpoint_security_group" {
+  type = object({
+    enabled              = optional(bool, true)
+    allowed_subnet_tiers = optional(list(string))
+    allowed_ipv4_cidrs   = optional(list(string), [])
+    allowed_ipv6_cidrs   = optional(list(string), [])
+  })
+  description = <<-EOT
+    Configuration of the security group created for the interface VPC endpoints, which allows HTTPS to the endpoints.
+      - `enabled`: Set `false` to not create the security group, and attach only the endpoints' `security_group_ids`.
+      - `allowed_subnet_tiers`: Subnet tiers whose subnet CIDRs may connect. Defaults to the VPC CIDR blocks the subnets are placed in
+        (and the base IPv6 CIDR block) instead.
+      - `allowed_ipv4_cidrs` and `allowed_ipv6_cidrs`: Additional CIDRs that may connect.
+    EOT
+  default     = {}
+  nullable    = false
+}
+
 #############################################################
 ############## NAT instance configuration ###################
 variable "nat_instance_type" {
   type        = string
-  description = "NAT Instance type"
+  description = <<-EOT
+    NAT Instance type. Graviton (ARM) instance types, such as `t4g.nano`, are supported:
+    when `nat_instance_ami_id` is empty, the AMI is looked up for the architecture of the instance type.
+    EOT
   default     = "t3.micro"
   nullable    = false
 }
 
+variable "nat_instance_spot" {
+  type = object({
+    enabled               = optional(bool, false)
+    max_price             = optional(string)
+    interruption_behavior = optional(string)
+  })
+  description = <<-EOT
+    Configuration for running the NAT instances as Spot Instances, to save on their cost.
+      - `enabled`: If `true`, request Spot Instances instead of On-Demand Instances.
+      - `max_price`: The maximum hourly price to pay. Defaults to the On-Demand price.
+      - `interruption_behavior`: What happens to a NAT instance when its Spot capacity is reclaimed, `stop` or `terminate`.
+        Defaults to `stop` for standalone NAT instances: stopped instances keep their ENI, so the routes to them work again once they restart.
+        With `nat_instance_auto_scaling_group_enabled`, interrupted instances are always terminated and replaced,
+        so only `terminate` may be set.
+    EOT
+  default     = {}
+  nullable    = false
+  validation {
+    condition     = contains(["stop", "terminate"], coalesce(var.nat_instance_spot.interruption_behavior, "stop"))
+    error_message = "`nat_instance_spot.interruption_behavior` must be \"stop\" or \"terminate\"."
+  }
+}
+
 variable "nat_instance_ami_id" {
   type        = list(string)
   description = <<-EOT
     A list optionally containing the ID of the AMI to use for the NAT instance.
-    If the list is empty (the default), the latest official AWS NAT instance AMI
-    will be used. NOTE: The Official NAT instance AMI is being phased out and
-    does not support NAT64. Use of a NAT gateway is recommended instead.
+    If the list is empty (the default), the latest AMI of `nat_instance_ami_family` will be used.
+    When supplying an AMI, set `nat_instance_ami_family` to the kind of AMI it is, so the instance is configured accordingly.
+    NOTE: Use of a NAT gateway is recommended for production workloads.
     EOT
   default     = []
   nullable    = false
@@ -585,6 +1391,148 @@ variable "nat_instance_ami_id" {
   }
 }
 
+variable "nat_instance_ami_family" {
+  type        = string
+  description = <<-EOT
+    The kind of AMI the NAT instances run, which determines the AMI used when `nat_instance_ami_id` is empty,
+    and how the instances are configured. One of:
+      - `al2023`: Amazon Linux 2023. User data enables IP forwarding and masquerades traffic from the VPC with iptables.
+      - `fck-nat`: The [fck-nat](https://fck-nat.dev) AMI, based on Amazon Linux 2023, which configures NAT itself.
+      - `amzn-ami-vpc-nat`: The official Amazon Linux NAT AMI, which is retired and no longer updated.
+        Only use this to keep existing NAT instances on it.
+    Versions before 3.0 always used `amzn-ami-vpc-nat`, so when upgrading, set this to `amzn-ami-vpc-nat`
+    to keep existing NAT instances: changing the AMI replaces them.
+    EOT
+  default     = "al2023"
+  nullable    = false
+  validation {
+    condition     = contains(["al2023", "fck-nat", "amzn-ami-vpc-nat"], var.nat_instance_ami_family)
+    error_message = "The `nat_instance_ami_family` must be one of \"al2023\", \"fck-nat\" or \"amzn-ami-vpc-nat\"."
+  }
+}
+
+variable "nat_instance_auto_scaling_group_enabled" {
+  type        = bool
+  description = <<-EOT
+    If `true`, run each NAT instance from a launch template in an Auto Scaling group of size 1 in its AZ,
+    so that a NAT instance that fails is replaced automatically. On boot, the instance associates its Elastic IP
+    and points the IPv4 default routes of the route tables it serves at itself, instead of the module managing those routes.
+    Each of these steps is retried for a few minutes, and an instance that still fails marks itself unhealthy, so that it is replaced.
+    This requires the instance metadata service (`metadata_http_endpoint_enabled`), and the instance role
+    the module creates for the NAT instances, unless `nat_instance_iam_instance_profile.name` supplies one with the same permissions.
+    EOT
+  default     = false
+  nullable    = false
+}
+
+variable "nat_instance_security_group" {
+  type = object({
+    allowed_ipv4_cidrs            = optional(list(string), [])
+    allowed_ipv6_cidrs            = optional(list(string), [])
+    allowed_prefix_list_ids       = optional(list(string), [])
+    additional_security_group_ids = optional(list(string), [])
+    egress_rules = optional(list(object({
+      description      = optional(string)
+      protocol         = optional(string, "-1")
+      from_port        = optional(number, 0)
+      to_port          = optional(number, 0)
+      cidr_blocks      = optional(list(string), [])
+      ipv6_cidr_blocks = optional(list(string), [])
+      prefix_list_ids  = optional(list(string), [])
+    })), [{ description = "Allow all egress traffic", cidr_blocks = ["0.0.0.0/0"] }])
+  })
+  description = <<-EOT
+    Configuration of the security group of the NAT instances, which by default allows all traffic from the subnets
+    that route to the NAT instances (the private subnets and the tiers with `egress = "nat"`), and all egress traffic.
+      - `allowed_ipv4_cidrs` and `allowed_ipv6_cidrs`: Additional CIDRs that may send traffic through the NAT instances.
+      - `allowed_prefix_list_ids`: Managed prefix lists that may send traffic through the NAT instances.
+      - `additional_security_group_ids`: Other security groups to attach to the NAT instances.
+      - `egress_rules`: The egress traffic the NAT instances allow. Defaults to all IPv4 traffic.
+        Each rule needs at least one of `cidr_blocks`, `ipv6_cidr_blocks` and `prefix_list_ids`.
+        This also restricts the traffic the NAT instances forward, since security groups apply to it.
+    EOT
+  default     = {}
+  nullable    = false
+  validation {
+    condition = alltrue([
+      for r in var.nat_instance_security_group.egress_rules : length(r.cidr_blocks) + length(r.ipv6_cidr_blocks) + length(r.prefix_list_ids) > 0
+    ])
+    error_message = "Each of `nat_instance_security_group.egress_rules` needs at least one of `cidr_blocks`, `ipv6_cidr_blocks` and `prefix_list_ids`."
+  }
+  validation {
+    condition     = length(var.nat_instance_security_group.egress_rules) > 0
+    error_message = "`nat_instance_security_group.egress_rules` must list at least one rule."
+  }
+}
+
+variable "nat_instance_iam_instance_profile" {
+  type = object({
+    enabled                  = optional(bool, false)
+    name                     = optional(string)
+    ssm_enabled              = optional(bool, true)
+    cloudwatch_agent_enabled = optional(bool, true)
+  })
+  description = <<-EOT
+    The IAM instance profile of the NAT instances, for example to reach them with Session Manager when debugging egress.
+      - `enabled`: If `true`, create an IAM role and instance profile for the NAT instances.
+        The module also creates them when the NAT instances need permissions of their own
+        (see `nat_instance_auto_scaling_group_enabled` and `nat_instance_metrics_enabled`).
+      - `name`: The name of an existing instance profile to use instead. It must grant any permissions the NAT instances need.
+      - `ssm_enabled`: With `enabled`, attach the `AmazonSSMManagedInstanceCore` policy to the role, for Session Manager.
+      - `cloudwatch_agent_enabled`: With `enabled`, attach the `CloudWatchAgentServerPolicy` policy to the role, for the CloudWatch agent.
+    EOT
+  default     = {}
+  nullable    = false
+  validation {
+    condition     = !(var.nat_instance_iam_instance_profile.enabled && var.nat_instance_iam_instance_profile.name != null)
+    error_message = "`nat_instance_iam_instance_profile` cannot both create an instance profile (`enabled`) and use an existing one (`name`)."
+  }
+}
+
+variable "nat_instance_metrics_enabled" {
+  type        = bool
+  description = <<-EOT
+    If `true`, the NAT instances publish the number of tracked connections (`ConntrackCount`), the connection tracking limit (`ConntrackMax`),
+    and the packets and bytes they masqueraded in the last minute (`MasqueradedPackets`, `MasqueradedBytes`)
+    to the `NATInstance` CloudWatch namespace every minute, with the `InstanceId` dimension.
+    This requires the instance metadata service (`metadata_http_endpoint_enabled`), the AWS CLI and systemd in the AMI
+    (so not `nat_instance_ami_family = "amzn-ami-vpc-nat"`, which is Amazon Linux 1),
+    and the instance profile to allow `cloudwatch:PutMetricData`, which the one the module creates does.
+    EOT
+  default     = false
+  nullable    = false
+}
+
+variable "nat_instance_nat64_enabled" {
+  type        = bool
+  description = <<-EOT
+    If `true`, the NAT instances also perform NAT64 with [TAYGA](https://github.com/apalrd/tayga),
+    built on first boot from the release set in `nat_instance_nat64_tayga_source`,
+    and the NAT64 prefix (`64:ff9b::/96`) of the private subnets and tiers with DNS64 enabled (see `private_dns64_nat64_enabled`)
+    is routed to the NAT instance in their AZ. The NAT instances get an IPv6 address, so the public subnets must have IPv6 enabled.
+    Only supported with `nat_instance_ami_family = "al2023"`.
+    EOT
+  default     = false
+  nullable    = false
+}
+
+variable "nat_instance_nat64_tayga_source" {
+  type = object({
+    url    = string
+    sha256 = string
+  })
+  description = <<-EOT
+    The TAYGA source archive the NAT instances build when `nat_instance_nat64_enabled` is `true`. Required in that case.
+      - `url`: The URL of a release archive, such as one from https://github.com/apalrd/tayga/releases.
+      - `sha256`: The SHA-256 checksum of the archive. The NAT instances do not build an archive that does not match it.
+    EOT
+  default     = null
+  validation {
+    condition     = var.nat_instance_nat64_tayga_source == null ? true : can(regex("^[0-9a-f]{64}$", var.nat_instance_nat64_tayga_source.sha256))
+    error_message = "The `sha256` of `nat_instance_nat64_tayga_source` must be a SHA-256 checksum of 64 lowercase hexadecimal digits."
+  }
+}
+
 variable "nat_instance_cpu_credits_override" {
   type        = string
   description = <<-EOT
@@ -0,0 +1,95 @@
+module "vpc_endpoint_label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+
+  attributes = ["vpce"]
+
+  context = module.this.context
+}
+
+data "aws_region" "current" {
+  count = local.vpc_endpoints_enabled ? 1 : 0
+}
+
+# Gateway endpoints are reached through routes the endpoint adds to its route tables
+resource "aws_vpc_endpoint" "gateway" {
+  for_each = local.gateway_vpc_endpoints
+
+  vpc_id            = local.vpc_id
+  service_name      = each.value.service_name
+  vpc_endpoint_type = "Gateway"
+  route_table_ids   = local.gateway_vpc_endpoint_route_table_ids[each.key]
+  policy            = each.value.policy
+
+  tags = merge(
+    module.vpc_endpoint_label.tags,
+    each.value.tags,
+    {
+      "Name" = format("%s%s%s", module.vpc_endpoint_label.id, local.delimiter, each.key)
+    }
+  )
+
+  lifecycle {
+    precondition {
+      condition     = length(local.gateway_vpc_endpoint_errors[each.key]) == 0
+      error_message = "The route tables for the `${each.key}` gateway VPC endpoint could not be found: ${join(", ", local.gateway_vpc_endpoint_errors[each.key])}."
+    }
+  }
+}
+
+resource "aws_security_group" "interface_vpc_endpoint" {
+  count = local.interface_vpc_endpoint_security_group_enabled ? 1 : 0
+
+  name        = module.vpc_endpoint_label.id
+  description = "Security Group for interface VPC endpoints"
+  vpc_id      = local.vpc_id
+  tags        = module.vpc_endpoint_label.tags
+
+  lifecycle {
+    precondition {
+      condition     = length(local.interface_vpc_endpoint_invalid_tiers) == 0
+      error_message = "`interface_vpc_endpoint_security_group.allowed_subnet_tiers` lists unknown subnet tiers: ${join(", ", local.interface_vpc_endpoint_invalid_tiers)}."
+    }
+  }
+}
+
+resource "aws_security_group_rule" "interface_vpc_endpoint_ingress" {
+  for_each = local.interface_vpc_endpoint_ingress_rules
+
+  description       = format("Allow HTTPS to the interface VPC endpoints from %s", each.key)
+  from_port         = 443
+  to_port           = 443
+  protocol          = "tcp"
+  cidr_blocks       = each.value.cidr_blocks
+  ipv6_cidr_blocks  = each.value.ipv6_cidr_blocks
+  security_group_id = join("", aws_security_group.interface_vpc_endpoint[*].id)
+  type              = "ingress"
+}
+
+# Interface endpoints place a network interface in one subnet per AZ
+resource "aws_vpc_endpoint" "interface" {
+  for_each = local.interface_vpc_endpoints
+
+  vpc_id              = local.vpc_id
+  service_name        = each.value.service_name
+  vpc_endpoint_type   = "Interface"
+  subnet_ids          = local.interface_vpc_endpoint_subnet_ids
+  security_group_ids  = concat(aws_security_group.interface_vpc_endpoint[*].id, each.value.security_group_ids)
+  private_dns_enabled = each.value.private_dns_enabled
+  policy              = each.value.policy
+
+  tags = merge(
+    module.vpc_endpoint_label.tags,
+    each.value.tags,
+    {
+      "Name" = format("%s%s%s", module.vpc_endpoint_label.id, local.delimiter, each.key)
+    }
+  )
+
+  lifecycle {
+    precondition {
+      condition     = local.interface_vpc_endpoint_subnets_valid
+      error_message = "Interface VPC endpoints need a private subnet named `${local.interface_vpc_endpoint_subnet_name}` in every AZ. Set `interface_vpc_endpoint_subnet_name` to one of `private_subnets_per_az_names`."
+    }
+  }
+}